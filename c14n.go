@@ -0,0 +1,336 @@
+package xg
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// C14NMethod selects the canonicalization algorithm of Canonicalize
+type C14NMethod int
+
+const (
+	C14N                = C14NMethod(iota) // Canonical XML 1.0
+	C14NWithComments                       // Canonical XML 1.0 with comments
+	ExcC14N                                // Exclusive XML Canonicalization 1.0
+	ExcC14NWithComments                    // Exclusive XML Canonicalization 1.0 with comments
+)
+
+func (m C14NMethod) exclusive() bool {
+	return m == ExcC14N || m == ExcC14NWithComments
+}
+
+func (m C14NMethod) comments() bool {
+	return m == C14NWithComments || m == ExcC14NWithComments
+}
+
+// Canonicalize writes the canonical form of a document or of the subtree of an
+// element, for example to compute a stable hash of a document parsed with
+// ParseDocument.
+//
+// The output does not depend on attribute order, quoting, empty-element form,
+// character references, CDATA sections or redundant namespace declarations.
+// Namespace declarations and xml: attributes in scope of a subtree are
+// included as the methods require. With exclusive methods, prefixes is the
+// InclusiveNamespaces PrefixList: namespaces that are declared as with
+// Canonical XML 1.0, "#default" stands for the default namespace.
+func Canonicalize(out io.Writer, n *Node, method C14NMethod, prefixes ...string) error {
+	c := &canonicalizer{w: bufio.NewWriter(out), method: method}
+	if method.exclusive() {
+		c.inclusive = map[string]bool{}
+		for _, p := range prefixes {
+			if p == "#default" {
+				p = ""
+			}
+			c.inclusive[p] = true
+		}
+	}
+
+	switch {
+	case n == nil:
+		return errors.New("xml c14n: nil node")
+	case n.Kind == DocumentNode:
+		afterRoot := false
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			switch ch.Kind {
+			case ElementNode:
+				c.element(ch, map[string]string{}, map[string]string{"": ""}, nil)
+				afterRoot = true
+			case CommentNode, PINode:
+				if ch.Kind == CommentNode && !method.comments() {
+					continue
+				}
+				if afterRoot {
+					c.put("\n")
+				}
+				c.node(ch)
+				if !afterRoot {
+					c.put("\n")
+				}
+			}
+		}
+	case n.Kind == ElementNode:
+		// the namespaces and xml: attributes in scope of the subtree
+		scope := map[string]string{}
+		var inherited []Attr
+		var ancestors []*Node
+		for e := n.Parent; e != nil && e.Kind == ElementNode; e = e.Parent {
+			ancestors = append(ancestors, e)
+		}
+		for i := len(ancestors) - 1; i >= 0; i-- {
+			for _, a := range ancestors[i].Attrs {
+				if prefix, ok := nsDecl(a.Name); ok {
+					scope[prefix] = a.Value
+				} else if strings.HasPrefix(string(a.Name), "xml:") && !method.exclusive() {
+					inherited = setAttr(inherited, a)
+				}
+			}
+		}
+		c.element(n, scope, map[string]string{"": ""}, inherited)
+	default:
+		c.node(n)
+	}
+	if c.err != nil {
+		return c.err
+	}
+	return c.w.Flush()
+}
+
+type canonicalizer struct {
+	w         *bufio.Writer
+	err       error
+	method    C14NMethod
+	inclusive map[string]bool // InclusiveNamespaces PrefixList of exclusive methods
+}
+
+func (c *canonicalizer) put(s string) {
+	if c.err == nil {
+		_, c.err = c.w.WriteString(s)
+	}
+}
+
+// nsDecl returns the prefix declared by a namespace declaration attribute
+func nsDecl(name NameString) (string, bool) {
+	if name == "xmlns" {
+		return "", true
+	}
+	if strings.HasPrefix(string(name), "xmlns:") {
+		return string(name[6:]), true
+	}
+	return "", false
+}
+
+// setAttr adds or replaces an attribute
+func setAttr(aa []Attr, a Attr) []Attr {
+	for i := range aa {
+		if aa[i].Name == a.Name {
+			aa[i] = a
+			return aa
+		}
+	}
+	return append(aa, a)
+}
+
+// node writes a child node of an element, or a node outside of the root
+// element
+func (c *canonicalizer) node(n *Node) {
+	switch n.Kind {
+	case TextNode, CDataNode:
+		c.put(escapeC14N(n.Value, false))
+	case CommentNode:
+		if c.method.comments() {
+			c.put("<!--")
+			c.put(n.Value)
+			c.put("-->")
+		}
+	case PINode:
+		c.put("<?")
+		c.put(string(n.Name))
+		if n.Value != "" {
+			c.put(" ")
+			c.put(n.Value)
+		}
+		c.put("?>")
+	}
+}
+
+// element writes an element. Scope holds the namespaces in scope of the
+// parent, rendered the namespaces declared by the output ancestors, extra the
+// xml: attributes inherited by the apex of a subtree.
+func (c *canonicalizer) element(n *Node, parentScope, rendered map[string]string, extra []Attr) {
+	scope, copied := parentScope, false
+	var attrs []Attr
+	for _, a := range n.Attrs {
+		if prefix, ok := nsDecl(a.Name); ok {
+			if !copied {
+				scope, copied = copyScope(parentScope), true
+			}
+			scope[prefix] = a.Value
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	for _, a := range extra {
+		if _, ok := findAttr(attrs, a.Name); !ok {
+			attrs = append(attrs, a)
+		}
+	}
+
+	// namespace declarations to render
+	var candidates []string
+	if c.method.exclusive() {
+		used := map[string]bool{n.Prefix(): true}
+		for _, a := range attrs {
+			if prefix, _ := splitQName(a.Name); prefix != "" {
+				used[prefix] = true
+			}
+		}
+		for p := range c.inclusive {
+			if _, ok := scope[p]; ok || p == "" {
+				used[p] = true
+			}
+		}
+		for p := range used {
+			candidates = append(candidates, p)
+		}
+	} else {
+		candidates = append(candidates, "")
+		for p := range scope {
+			if p != "" {
+				candidates = append(candidates, p)
+			}
+		}
+	}
+	sort.Strings(candidates)
+	var decls []Attr
+	for _, p := range candidates {
+		if p == "xml" {
+			continue
+		}
+		uri, ok := scope[p]
+		if p != "" && (!ok || uri == "") {
+			continue // undeclared
+		}
+		if prev, ok := rendered[p]; ok && prev == uri {
+			continue
+		}
+		if p == "" {
+			decls = append(decls, Attr{Name: "xmlns", Value: uri})
+		} else {
+			decls = append(decls, Attr{Name: NameString("xmlns:" + p), Value: uri})
+		}
+	}
+	if len(decls) > 0 {
+		r := make(map[string]string, len(rendered)+len(decls))
+		for p, uri := range rendered {
+			r[p] = uri
+		}
+		for _, d := range decls {
+			p, _ := nsDecl(d.Name)
+			r[p] = d.Value
+		}
+		rendered = r
+	}
+
+	// attributes sort by namespace URI, then by local name
+	type key struct{ uri, local string }
+	keys := make([]key, len(attrs))
+	for i, a := range attrs {
+		prefix, local := splitQName(a.Name)
+		keys[i].local = local
+		switch prefix {
+		case "":
+		case "xml":
+			keys[i].uri = xmlNamespaceURI
+		default:
+			keys[i].uri = scope[prefix]
+		}
+	}
+	idx := make([]int, len(attrs))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		a, b := keys[idx[i]], keys[idx[j]]
+		if a.uri != b.uri {
+			return a.uri < b.uri
+		}
+		return a.local < b.local
+	})
+
+	c.put("<")
+	c.put(string(n.Name))
+	for _, d := range decls {
+		c.putAttr(d)
+	}
+	for _, i := range idx {
+		c.putAttr(attrs[i])
+	}
+	c.put(">")
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if ch.Kind == ElementNode {
+			c.element(ch, scope, rendered, nil)
+		} else {
+			c.node(ch)
+		}
+	}
+	c.put("</")
+	c.put(string(n.Name))
+	c.put(">")
+}
+
+func (c *canonicalizer) putAttr(a Attr) {
+	c.put(" ")
+	c.put(string(a.Name))
+	c.put(`="`)
+	c.put(escapeC14N(a.Value, true))
+	c.put(`"`)
+}
+
+func copyScope(m map[string]string) map[string]string {
+	r := make(map[string]string, len(m)+1)
+	for p, uri := range m {
+		r[p] = uri
+	}
+	return r
+}
+
+func findAttr(aa []Attr, name NameString) (int, bool) {
+	for i, a := range aa {
+		if a.Name == name {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// escapeC14N escapes text or attribute values as canonical XML requires
+func escapeC14N(s string, attr bool) string {
+	if !strings.ContainsAny(s, "&<>\"\t\n\r") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '&':
+			b.WriteString("&amp;")
+		case c == '<':
+			b.WriteString("&lt;")
+		case c == '\r':
+			b.WriteString("&#xD;")
+		case c == '>' && !attr:
+			b.WriteString("&gt;")
+		case c == '"' && attr:
+			b.WriteString("&quot;")
+		case c == '\t' && attr:
+			b.WriteString("&#x9;")
+		case c == '\n' && attr:
+			b.WriteString("&#xA;")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
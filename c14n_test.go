@@ -0,0 +1,150 @@
+package xg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func canonical(t *testing.T, n *Node, method C14NMethod, prefixes ...string) string {
+	t.Helper()
+	out := &bytes.Buffer{}
+	if err := Canonicalize(out, n, method, prefixes...); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestCanonicalize(t *testing.T) {
+	const prolog = `<?xml version="1.0" encoding="UTF-8"?>
+
+<?xml-stylesheet   href="doc.xsl"
+   type="text/xsl"   ?>
+
+<!DOCTYPE doc SYSTEM "doc.dtd">
+
+<doc>Hello, world!<!-- Comment 1 --></doc>
+
+<?pi-without-data     ?>
+
+<!-- Comment 2 -->
+
+<!-- Comment 3 -->
+`
+	const tags = `<doc>
+   <e1   />
+   <e2   ></e2>
+   <e3   name = "elem3"   id="elem3"   />
+   <e4   name="elem4"   id="elem4"   ></e4>
+   <e5 a:attr="out" b:attr="sorted" attr2="all" attr="I'm"
+      xmlns:b="http://www.ietf.org"
+      xmlns:a="http://www.w3.org"
+      xmlns="http://example.org"/>
+   <e6 xmlns="" xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="" xmlns:a="http://www.w3.org">
+            <e9 xmlns="" xmlns:a="http://www.ietf.org"/>
+         </e8>
+      </e7>
+   </e6>
+</doc>`
+	const chars = "<doc>\r\n<text>First line&#x0d;&#10;Second line</text>" +
+		"<value>&#x32;</value><compute><![CDATA[value>\"0\" && value<\"10\" ?\"valid\":\"error\"]]></compute>" +
+		"<norm attr=' &apos;   &#x20;&#13;&#xa;&#9;   &apos; '/><normId id=' &apos;   &#x20;&#13;&#xa;&#9;   &apos; '/></doc>"
+
+	tests := []struct {
+		name   string
+		in     string
+		method C14NMethod
+		want   string
+	}{
+		{"prolog", prolog, C14N, `<?xml-stylesheet href="doc.xsl"
+   type="text/xsl"   ?>
+<doc>Hello, world!</doc>
+<?pi-without-data?>`},
+		{"prolog comments", prolog, C14NWithComments, `<?xml-stylesheet href="doc.xsl"
+   type="text/xsl"   ?>
+<doc>Hello, world!<!-- Comment 1 --></doc>
+<?pi-without-data?>
+<!-- Comment 2 -->
+<!-- Comment 3 -->`},
+		{"tags", tags, C14N, `<doc>
+   <e1></e1>
+   <e2></e2>
+   <e3 id="elem3" name="elem3"></e3>
+   <e4 id="elem4" name="elem4"></e4>
+   <e5 xmlns="http://example.org" xmlns:a="http://www.w3.org" xmlns:b="http://www.ietf.org" attr="I'm" attr2="all" b:attr="sorted" a:attr="out"></e5>
+   <e6 xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="">
+            <e9 xmlns:a="http://www.ietf.org"></e9>
+         </e8>
+      </e7>
+   </e6>
+</doc>`},
+		{"tags exclusive", tags, ExcC14N, `<doc>
+   <e1></e1>
+   <e2></e2>
+   <e3 id="elem3" name="elem3"></e3>
+   <e4 id="elem4" name="elem4"></e4>
+   <e5 xmlns="http://example.org" xmlns:a="http://www.w3.org" xmlns:b="http://www.ietf.org" attr="I'm" attr2="all" b:attr="sorted" a:attr="out"></e5>
+   <e6>
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="">
+            <e9></e9>
+         </e8>
+      </e7>
+   </e6>
+</doc>`},
+		{"chars", chars, C14N, "<doc>\n<text>First line&#xD;\nSecond line</text><value>2</value>" +
+			"<compute>value&gt;\"0\" &amp;&amp; value&lt;\"10\" ?\"valid\":\"error\"</compute>" +
+			"<norm attr=\" '    &#xD;&#xA;&#x9;   ' \"></norm><normId id=\" '    &#xD;&#xA;&#x9;   ' \"></normId></doc>"},
+		{"crlf", "<a><![CDATA[c\r\nd\re]]><!--f\r\ng--><?p h\r\ni?></a>", C14NWithComments,
+			"<a>c\nd\ne<!--f\ng--><?p h\ni?></a>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseDocument(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := canonical(t, doc, tt.method); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeSubtree(t *testing.T) {
+	doc, err := ParseDocument(`<n0:local xmlns:n0="foo:bar" xmlns:n3="ftp://example.org" xml:space="preserve">
+  <n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+    <n3:stuff xmlns:n3="ftp://example.org"/>
+  </n1:elem2>
+</n0:local>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elem := doc.Root().Elements()[0]
+	tests := []struct {
+		name     string
+		method   C14NMethod
+		prefixes []string
+		want     string
+	}{
+		{"inclusive", C14N, nil, `<n1:elem2 xmlns:n0="foo:bar" xmlns:n1="http://example.net" xmlns:n3="ftp://example.org" xml:lang="en" xml:space="preserve">
+    <n3:stuff></n3:stuff>
+  </n1:elem2>`},
+		{"exclusive", ExcC14N, nil, `<n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+    <n3:stuff xmlns:n3="ftp://example.org"></n3:stuff>
+  </n1:elem2>`},
+		{"prefix list", ExcC14N, []string{"n0", "#default"}, `<n1:elem2 xmlns:n0="foo:bar" xmlns:n1="http://example.net" xml:lang="en">
+    <n3:stuff xmlns:n3="ftp://example.org"></n3:stuff>
+  </n1:elem2>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canonical(t, elem, tt.method, tt.prefixes...); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,833 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/types"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const xgPath = "github.com/adnsv/xmlgo"
+
+// methods that make the reflection path bypass field tags
+var codecMethods = []string{"MarshalXG", "UnmarshalXG", "MarshalText", "UnmarshalText", "MarshalXGAttr", "UnmarshalXGAttr"}
+
+type fieldMode int
+
+const (
+	mElement = fieldMode(iota)
+	mAttr
+	mCharData
+	mInnerXML
+	mComment
+	mAny
+)
+
+// field is the XML mapping of a struct field, see typeinfo.go in package xg
+type field struct {
+	sel       string // selector relative to the struct value
+	goName    string
+	name      string
+	parents   []string
+	mode      fieldMode
+	omitEmpty bool
+	cdata     bool // chardata written as a CDATA section
+	typ       types.Type
+	depth     int
+}
+
+// valueKind tells how a value is converted to and from text
+type valueKind int
+
+const (
+	vFallback = valueKind(iota) // passed to the reflection path
+	vString
+	vBytes
+	vInt
+	vUint
+	vFloat
+	vBool
+	vStruct // a generated type
+)
+
+// valueInfo describes a field type, pointers and slices are unwrapped one
+// level at most
+type valueInfo struct {
+	kind  valueKind
+	bits  string
+	ptr   bool       // value is accessed through a pointer
+	slice bool       // repeated element
+	elem  types.Type // type after unwrapping
+}
+
+type generator struct {
+	pkg     *types.Package
+	types   []*types.Named
+	imports map[string]string // path -> name
+	buf     bytes.Buffer
+}
+
+func newGenerator(pkg *types.Package) *generator {
+	return &generator{pkg: pkg, imports: map[string]string{"xg": xgPath}}
+}
+
+func (g *generator) addType(name string) error {
+	obj := g.pkg.Scope().Lookup(name)
+	if obj == nil {
+		return fmt.Errorf("type %s not found", name)
+	}
+	named, ok := obj.Type().(*types.Named)
+	if !ok {
+		return fmt.Errorf("%s is not a named type", name)
+	}
+	if _, ok := named.Underlying().(*types.Struct); !ok {
+		return fmt.Errorf("%s is not a struct type", name)
+	}
+	if m := codecMethod(named); m != "" {
+		return fmt.Errorf("%s has method %s, it does not use field tags", name, m)
+	}
+	g.types = append(g.types, named)
+	return nil
+}
+
+func (g *generator) isGenerated(t types.Type) bool {
+	for _, n := range g.types {
+		if types.Identical(n, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// codecMethod returns the name of the first method of *t that the reflection
+// path prefers over field tags and basic conversions
+func codecMethod(t types.Type) string {
+	mset := types.NewMethodSet(types.NewPointer(t))
+	for _, name := range codecMethods {
+		if mset.Lookup(nil, name) != nil {
+			return name
+		}
+	}
+	return ""
+}
+
+func (g *generator) qualifier(p *types.Package) string {
+	if p == g.pkg {
+		return ""
+	}
+	g.imports[p.Name()] = p.Path()
+	return p.Name()
+}
+
+func (g *generator) typeString(t types.Type) string {
+	return types.TypeString(t, g.qualifier)
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// generate returns the formatted source of the generated file
+func (g *generator) generate(cmd string) ([]byte, error) {
+	body := bytes.Buffer{}
+	for _, t := range g.types {
+		fields, err := g.fields(t)
+		if err != nil {
+			return nil, err
+		}
+		g.buf.Reset()
+		g.genDecode(t, fields)
+		g.genEncode(t, fields)
+		body.Write(g.buf.Bytes())
+	}
+
+	g.buf.Reset()
+	g.printf("// Code generated by %s; DO NOT EDIT.\n\n", cmd)
+	g.printf("package %s\n\n", g.pkg.Name())
+	var names []string
+	for name := range g.imports {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := g.imports[names[i]], g.imports[names[j]]
+		if stdA, stdB := !strings.Contains(a, "."), !strings.Contains(b, "."); stdA != stdB {
+			return stdA
+		}
+		return a < b
+	})
+	g.printf("import (\n")
+	for i, name := range names {
+		path := g.imports[name]
+		if i > 0 && strings.Contains(path, ".") && !strings.Contains(g.imports[names[i-1]], ".") {
+			g.printf("\n")
+		}
+		if name == path || strings.HasSuffix(path, "/"+name) {
+			g.printf("\t%q\n", path)
+		} else {
+			g.printf("\t%s %q\n", name, path)
+		}
+	}
+	g.printf(")\n\n")
+	g.buf.Write(body.Bytes())
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v\n%s", err, g.buf.Bytes())
+	}
+	return src, nil
+}
+
+// fields returns the XML mapping of the struct fields, following the rules of
+// the reflection path
+func (g *generator) fields(t *types.Named) ([]field, error) {
+	var fields []field
+	var add func(st *types.Struct, sel string, depth int) error
+	add = func(st *types.Struct, sel string, depth int) error {
+		for i := 0; i < st.NumFields(); i++ {
+			f := st.Field(i)
+			tag, tagged := reflect.StructTag(st.Tag(i)).Lookup("xg")
+			if !tagged {
+				tag, tagged = reflect.StructTag(st.Tag(i)).Lookup("xml")
+			}
+			if tag == "-" {
+				continue
+			}
+			if f.Name() == "XMLName" {
+				return fmt.Errorf("%s: XMLName fields are not supported", t.Obj().Name())
+			}
+			if f.Anonymous() && !tagged {
+				ft := f.Type()
+				if p, ok := ft.(*types.Pointer); ok {
+					if _, ok := p.Elem().Underlying().(*types.Struct); ok {
+						return fmt.Errorf("%s: embedded pointer %s is not supported", t.Obj().Name(), f.Name())
+					}
+				}
+				if est, ok := ft.Underlying().(*types.Struct); ok {
+					if err := add(est, sel+f.Name()+".", depth+1); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			if !f.Exported() {
+				continue
+			}
+			fi, err := parseTag(f.Name(), tag)
+			if err != nil {
+				return err
+			}
+			fi.sel, fi.goName, fi.typ, fi.depth = sel+f.Name(), f.Name(), f.Type(), depth
+			fields = append(fields, fi)
+		}
+		return nil
+	}
+	if err := add(t.Underlying().(*types.Struct), "", 1); err != nil {
+		return nil, err
+	}
+
+	// shallowest fields hide deeper ones with the same name
+	key := func(f *field) string {
+		switch f.mode {
+		case mElement:
+			return "e:" + strings.Join(append(f.parents[:len(f.parents):len(f.parents)], f.name), ">")
+		case mAttr:
+			return "a:" + f.name
+		}
+		return strconv.Itoa(int(f.mode))
+	}
+	best := map[string]int{}
+	for i := range fields {
+		k := key(&fields[i])
+		j, ok := best[k]
+		if !ok {
+			best[k] = i
+			continue
+		}
+		if fields[i].depth == fields[j].depth {
+			return nil, fmt.Errorf("xg: %s has conflicting fields for %q", t, fields[i].name)
+		}
+		if fields[i].depth < fields[j].depth {
+			best[k] = i
+		}
+	}
+	kept := fields[:0]
+	for i := range fields {
+		if best[key(&fields[i])] == i {
+			kept = append(kept, fields[i])
+		}
+	}
+
+	for _, f := range kept {
+		switch f.mode {
+		case mInnerXML, mAny:
+			return nil, fmt.Errorf("%s.%s: innerxml and any fields are not supported", t.Obj().Name(), f.goName)
+		case mCharData, mComment:
+			if vi := g.valueInfo(f.typ, false); vi.kind == vFallback || vi.kind == vStruct ||
+				(f.mode == mComment && vi.kind != vString && vi.kind != vBytes) {
+				return nil, fmt.Errorf("%s.%s: unsupported type %s", t.Obj().Name(), f.goName, f.typ)
+			}
+		}
+		if _, ok := g.elemType(f.typ).Underlying().(*types.Interface); ok {
+			return nil, fmt.Errorf("%s.%s: interface fields are not supported", t.Obj().Name(), f.goName)
+		}
+	}
+	return kept, nil
+}
+
+// parseTag mirrors parseFieldTag of package xg
+func parseTag(goName, tag string) (field, error) {
+	f := field{}
+	tokens := strings.Split(tag, ",")
+	f.name = tokens[0]
+	if i := strings.LastIndexByte(f.name, ' '); i >= 0 {
+		f.name = f.name[i+1:]
+	}
+	if strings.Contains(f.name, ">") {
+		path := strings.Split(f.name, ">")
+		for _, p := range path {
+			if p == "" {
+				return f, fmt.Errorf("xg: invalid tag %q on field %s: empty element name", tag, goName)
+			}
+		}
+		f.parents, f.name = path[:len(path)-1], path[len(path)-1]
+	}
+	modes := map[fieldMode]bool{}
+	for _, flag := range tokens[1:] {
+		switch flag {
+		case "attr":
+			f.mode = mAttr
+		case "chardata":
+			f.mode = mCharData
+		case "cdata":
+			f.mode, f.cdata = mCharData, true
+		case "innerxml":
+			f.mode = mInnerXML
+		case "comment":
+			f.mode = mComment
+		case "any":
+			f.mode = mAny
+		case "omitempty":
+			f.omitEmpty = true
+			continue
+		default:
+			return f, fmt.Errorf("xg: invalid tag %q on field %s: unknown flag '%s'", tag, goName, flag)
+		}
+		modes[f.mode] = true
+	}
+	if len(modes) > 1 {
+		return f, fmt.Errorf("xg: invalid tag %q on field %s: conflicting flags", tag, goName)
+	}
+	switch f.mode {
+	case mAttr, mAny:
+		if f.parents != nil {
+			return f, fmt.Errorf("xg: invalid tag %q on field %s: a>b is only allowed on elements", tag, goName)
+		}
+	case mCharData, mInnerXML, mComment:
+		if f.name != "" {
+			return f, fmt.Errorf("xg: invalid tag %q on field %s: name is not allowed", tag, goName)
+		}
+	}
+	if f.name == "" {
+		f.name = goName
+	}
+	return f, nil
+}
+
+// elemType unwraps pointers and slices
+func (g *generator) elemType(t types.Type) types.Type {
+	for {
+		switch u := t.Underlying().(type) {
+		case *types.Pointer:
+			t = u.Elem()
+		case *types.Slice:
+			if isBytes(t) {
+				return t
+			}
+			t = u.Elem()
+		default:
+			return t
+		}
+	}
+}
+
+func isBytes(t types.Type) bool {
+	s, ok := t.Underlying().(*types.Slice)
+	return ok && types.Identical(s.Elem(), types.Typ[types.Byte])
+}
+
+// valueInfo classifies the type of a field, repeated allows slices of
+// elements
+func (g *generator) valueInfo(t types.Type, repeated bool) valueInfo {
+	vi := valueInfo{}
+	if repeated && !isBytes(t) && codecMethod(t) == "" {
+		if s, ok := t.Underlying().(*types.Slice); ok {
+			vi.slice = true
+			t = s.Elem()
+		}
+	}
+	if p, ok := t.(*types.Pointer); ok {
+		vi.ptr = true
+		t = p.Elem()
+	}
+	vi.elem = t
+	vi.kind, vi.bits = g.classify(t)
+	if vi.slice && vi.kind == vFallback {
+		// the whole slice is passed to the reflection path
+		vi.slice, vi.ptr = false, false
+	}
+	return vi
+}
+
+// canFail reports whether decoding text into the value may fail
+func (vi valueInfo) canFail() bool {
+	return vi.kind != vString && vi.kind != vBytes
+}
+
+func (g *generator) classify(t types.Type) (valueKind, string) {
+	if g.isGenerated(t) {
+		return vStruct, ""
+	}
+	if codecMethod(t) != "" {
+		return vFallback, ""
+	}
+	if isBytes(t) {
+		return vBytes, ""
+	}
+	b, ok := t.Underlying().(*types.Basic)
+	if !ok {
+		return vFallback, ""
+	}
+	switch b.Kind() {
+	case types.String:
+		return vString, ""
+	case types.Bool:
+		return vBool, ""
+	case types.Int:
+		return vInt, "strconv.IntSize"
+	case types.Int8:
+		return vInt, "8"
+	case types.Int16:
+		return vInt, "16"
+	case types.Int32:
+		return vInt, "32"
+	case types.Int64:
+		return vInt, "64"
+	case types.Uint, types.Uintptr:
+		return vUint, "strconv.IntSize"
+	case types.Uint8:
+		return vUint, "8"
+	case types.Uint16:
+		return vUint, "16"
+	case types.Uint32:
+		return vUint, "32"
+	case types.Uint64:
+		return vUint, "64"
+	case types.Float32:
+		return vFloat, "32"
+	case types.Float64:
+		return vFloat, "64"
+	}
+	return vFallback, ""
+}
+
+// emptyCheck returns a condition that is true when the value of the field is
+// written, following isNilValue and isEmptyValue of package xg
+func emptyCheck(x string, t types.Type, omitEmpty bool) string {
+	switch u := t.Underlying().(type) {
+	case *types.Pointer, *types.Interface:
+		return x + " != nil"
+	case *types.Slice, *types.Map, *types.Array:
+		if omitEmpty {
+			return "len(" + x + ") != 0"
+		}
+	case *types.Basic:
+		if !omitEmpty {
+			break
+		}
+		switch {
+		case u.Info()&types.IsString != 0:
+			return "len(" + x + ") != 0"
+		case u.Info()&types.IsBoolean != 0:
+			return "bool(" + x + ")"
+		case u.Info()&(types.IsInteger|types.IsFloat) != 0:
+			return x + " != 0"
+		}
+	}
+	return ""
+}
+
+// formatExpr converts x to text, following marshalSimple of package xg
+func (g *generator) formatExpr(x string, vi valueInfo) string {
+	if vi.kind != vString && vi.kind != vBytes {
+		g.imports["strconv"] = "strconv"
+	}
+	switch vi.kind {
+	case vString, vBytes:
+		return g.convert(vi.elem, "string", x)
+	case vInt:
+		return "strconv.FormatInt(" + g.convert(vi.elem, "int64", x) + ", 10)"
+	case vUint:
+		return "strconv.FormatUint(" + g.convert(vi.elem, "uint64", x) + ", 10)"
+	case vFloat:
+		return "strconv.FormatFloat(" + g.convert(vi.elem, "float64", x) + ", 'g', -1, " + vi.bits + ")"
+	case vBool:
+		return "strconv.FormatBool(" + g.convert(vi.elem, "bool", x) + ")"
+	}
+	panic("unexpected value kind")
+}
+
+// convert returns x converted to the named type, unless it already has
+// that type
+func (g *generator) convert(from types.Type, to string, x string) string {
+	if g.typeString(from) == to {
+		return x
+	}
+	return to + "(" + x + ")"
+}
+
+// genParse writes statements that parse s into x, fallback is the statement
+// that reproduces the error of the reflection path
+func (g *generator) genParse(x string, vi valueInfo, fallback string) {
+	typ := g.typeString(vi.elem)
+	if vi.ptr {
+		g.printf("if %s == nil {\n%s = new(%s)\n}\n", x, x, typ)
+		x = "*" + x
+	}
+	parse := ""
+	switch vi.kind {
+	case vString, vBytes:
+		g.printf("%s = %s\n", x, g.convert(types.Typ[types.String], typ, "s"))
+		return
+	case vInt:
+		parse = "xg.ParseInt(s, " + vi.bits + ")"
+	case vUint:
+		parse = "xg.ParseUint(s, " + vi.bits + ")"
+	case vFloat:
+		parse = "xg.ParseFloat(s, " + vi.bits + ")"
+	case vBool:
+		parse = "xg.ParseBool(s)"
+	}
+	if strings.Contains(vi.bits, "strconv.") {
+		g.imports["strconv"] = "strconv"
+	}
+	from := map[valueKind]types.Type{
+		vInt:   types.Typ[types.Int64],
+		vUint:  types.Typ[types.Uint64],
+		vFloat: types.Typ[types.Float64],
+		vBool:  types.Typ[types.Bool],
+	}[vi.kind]
+	g.printf("n, err := %s\nif err != nil {\n%s\n}\n%s = %s\n", parse, fallback, x, g.convert(from, typ, "n"))
+}
+
+func (g *generator) genDecode(t *types.Named, fields []field) {
+	name := t.Obj().Name()
+	needPath, needTextPos := false, false
+	hasContent, hasCharData, hasComments := false, false, false
+	for _, f := range fields {
+		switch f.mode {
+		case mAttr:
+			needPath = needPath || g.valueInfo(f.typ, false).canFail()
+		case mElement:
+			hasContent = true
+		case mCharData:
+			hasContent, hasCharData = true, true
+			needTextPos = needTextPos || g.valueInfo(f.typ, false).canFail()
+		case mComment:
+			hasContent, hasComments = true, true
+		}
+	}
+
+	g.printf("// DecodeXG decodes the current tag of ci into v\n")
+	g.printf("func (v *%s) DecodeXG(ci *xg.Content) error {\n", name)
+	if needPath {
+		g.printf("path := ci.TagPath()\n")
+	}
+	g.printf("ci.HandleTag(func(attrs xg.AttributeList, content *xg.Content) error {\n")
+	g.printf("attrs.MarkNamespaces()\n")
+	for _, f := range fields {
+		if f.mode != mAttr {
+			continue
+		}
+		x := "v." + f.sel
+		vi := g.valueInfo(f.typ, false)
+		if vi.kind == vFallback || vi.kind == vStruct {
+			g.printf("if err := ci.DecodeAttr(attrs, %q, path, &%s); err != nil {\nreturn err\n}\n", f.name, x)
+			continue
+		}
+		g.printf("if s, ok := attrs.Attr(%q); ok {\n", f.name)
+		g.genParse(x, vi, fmt.Sprintf("return ci.DecodeAttr(attrs, %q, path, &%s)", f.name, x))
+		g.printf("}\n")
+	}
+	if !hasContent {
+		g.printf("return nil\n})\nreturn ci.Err()\n}\n\n")
+		return
+	}
+
+	g.printf("if content == nil {\nreturn nil\n}\n")
+	if hasCharData {
+		g.printf("var chardata strings.Builder\n")
+		if needTextPos {
+			g.printf("textPos := -1\n")
+		}
+		g.imports["strings"] = "strings"
+	}
+	if hasComments {
+		g.printf("var comments strings.Builder\n")
+		g.imports["strings"] = "strings"
+	}
+	g.printf("for content.Next() {\nswitch content.Kind() {\ncase xg.Tag:\n")
+	g.genTagSwitch(fields, nil)
+	if hasCharData {
+		g.printf("case xg.SData, xg.CData:\n")
+		if needTextPos {
+			g.printf("if textPos < 0 {\ntextPos = content.Token().SrcPos\n}\n")
+		}
+		g.printf("if content.IsCData() {\nchardata.WriteString(string(content.Value()))\n} else {\nchardata.WriteString(content.Value().Unscrambled())\n}\n")
+	}
+	if hasComments {
+		g.printf("case xg.Comment:\ncomments.WriteString(string(content.Value()))\n")
+	}
+	g.printf("}\n}\n")
+	g.printf("if err := content.Err(); err != nil {\nreturn err\n}\n")
+	for _, f := range fields {
+		switch f.mode {
+		case mCharData:
+			x := "v." + f.sel
+			g.printf("{\ns := chardata.String()\n")
+			g.genParse(x, g.valueInfo(f.typ, false), fmt.Sprintf("return content.DecodeText(textPos, s, &%s)", x))
+			g.printf("}\n")
+		case mComment:
+			g.printf("{\ns := comments.String()\n")
+			g.genParse("v."+f.sel, g.valueInfo(f.typ, false), "")
+			g.printf("}\n")
+		}
+	}
+	g.printf("return nil\n})\nreturn ci.Err()\n}\n\n")
+}
+
+// genTagSwitch dispatches the current tag of content to the element fields
+// enclosed in parents
+func (g *generator) genTagSwitch(fields []field, parents []string) {
+	g.printf("switch content.Name() {\n")
+	seen := map[string]bool{}
+	for _, f := range fields {
+		if f.mode != mElement || !equalNames(f.parents, parents) || seen[f.name] {
+			continue
+		}
+		seen[f.name] = true
+		g.printf("case %q:\n", f.name)
+		g.genElementDecode(f)
+	}
+	n := len(parents)
+	for _, f := range fields {
+		if f.mode != mElement || len(f.parents) <= n || !equalNames(f.parents[:n], parents) || seen[f.parents[n]] {
+			continue
+		}
+		name := f.parents[n]
+		seen[name] = true
+		g.printf("case %q:\n", name)
+		g.printf("content.HandleTag(func(_ xg.AttributeList, content *xg.Content) error {\n")
+		g.printf("for content.NextTag() {\n")
+		g.genTagSwitch(fields, append(parents[:n:n], name))
+		g.printf("}\nreturn content.Err()\n})\n")
+	}
+	g.printf("}\n")
+}
+
+func (g *generator) genElementDecode(f field) {
+	x := "v." + f.sel
+	vi := g.valueInfo(f.typ, true)
+	switch {
+	case vi.kind == vFallback:
+		g.printf("if err := content.DecodeChild(&%s); err != nil {\nreturn err\n}\n", x)
+	case vi.kind == vStruct:
+		typ := g.typeString(vi.elem)
+		switch {
+		case vi.slice && vi.ptr:
+			g.printf("e := new(%s)\n", typ)
+		case vi.slice:
+			g.printf("var e %s\n", typ)
+		case vi.ptr:
+			g.printf("if %s == nil {\n%s = new(%s)\n}\n", x, x, typ)
+		}
+		target := x
+		if vi.slice {
+			target = "e"
+		}
+		g.printf("if err := %s.DecodeXG(content); err != nil {\nreturn err\n}\n", target)
+		if vi.slice {
+			g.printf("%s = append(%s, e)\n", x, x)
+		}
+	default:
+		g.printf("content.HandleTag(func(attrs xg.AttributeList, content *xg.Content) error {\n")
+		g.printf("attrs.MarkNamespaces()\n")
+		pos := "_"
+		if vi.canFail() {
+			pos = "pos"
+		}
+		g.printf("s, %s, err := content.CharData()\nif err != nil {\nreturn err\n}\n", pos)
+		target := x
+		if vi.slice {
+			typ := g.typeString(vi.elem)
+			if vi.ptr {
+				typ = "*" + typ
+			}
+			g.printf("var e %s\n", typ)
+			target = "e"
+		}
+		g.genParse(target, vi, fmt.Sprintf("return content.DecodeText(pos, s, &%s)", target))
+		if vi.slice {
+			g.printf("%s = append(%s, e)\n", x, x)
+		}
+		g.printf("return nil\n})\n")
+	}
+}
+
+func (g *generator) genEncode(t *types.Named, fields []field) {
+	name := t.Obj().Name()
+	g.printf("// EncodeXG writes v as an element with the given name\n")
+	g.printf("func (v *%s) EncodeXG(w *xg.Writer, name string) error {\n", name)
+	g.printf("w.OTag(name)\n")
+	nested := false
+	for _, f := range fields {
+		if f.mode == mAttr {
+			g.genAttrEncode(f)
+		}
+		if len(f.parents) > 0 {
+			nested = true
+		}
+	}
+	if nested {
+		g.printf("var parents []string\n")
+		g.printf("setParents := func(names ...string) {\n")
+		g.printf("n := 0\nfor n < len(parents) && n < len(names) && parents[n] == names[n] {\nn++\n}\n")
+		g.printf("for len(parents) > n {\nw.CTag()\nparents = parents[:len(parents)-1]\n}\n")
+		g.printf("for _, name := range names[n:] {\nw.OTag(name)\nparents = append(parents, name)\n}\n")
+		g.printf("}\n")
+	}
+	// parents are closed by every field other than elements, as the
+	// reflection path does
+	open := false
+	for _, f := range fields {
+		x := "v." + f.sel
+		if f.mode != mElement {
+			if open {
+				g.printf("setParents()\n")
+				open = false
+			}
+		}
+		switch f.mode {
+		case mElement:
+			cond := emptyCheck(x, f.typ, f.omitEmpty)
+			if cond != "" {
+				g.printf("if %s {\n", cond)
+			}
+			if nested {
+				g.printf("setParents(")
+				for i, p := range f.parents {
+					if i > 0 {
+						g.printf(", ")
+					}
+					g.printf("%q", p)
+				}
+				g.printf(")\n")
+				open = true
+			}
+			g.genElementEncode(f, cond != "")
+			if cond != "" {
+				g.printf("}\n")
+			}
+		case mCharData, mComment:
+			vi := g.valueInfo(f.typ, false)
+			if vi.ptr {
+				g.printf("if %s != nil {\n", x)
+				x = "*" + x
+			}
+			g.printf("if s := %s; s != \"\" {\n", g.formatExpr(x, vi))
+			if f.cdata {
+				g.printf("w.CData(s)\n")
+			} else if f.mode == mCharData {
+				g.printf("w.String(s)\n")
+			} else {
+				g.printf("w.Comment(s)\n")
+			}
+			g.printf("}\n")
+			if vi.ptr {
+				g.printf("}\n")
+			}
+		}
+	}
+	if open {
+		g.printf("setParents()\n")
+	}
+	g.printf("w.CTag()\nreturn nil\n}\n\n")
+}
+
+func (g *generator) genAttrEncode(f field) {
+	x := "v." + f.sel
+	cond := emptyCheck(x, f.typ, f.omitEmpty)
+	if cond != "" {
+		g.printf("if %s {\n", cond)
+	}
+	vi := g.valueInfo(f.typ, false)
+	if vi.kind == vFallback || vi.kind == vStruct {
+		g.printf("w.Attr(%q, &%s)\n", f.name, x)
+	} else {
+		if vi.ptr {
+			x = "*" + x
+		}
+		g.printf("w.StringAttr(%q, %s)\n", f.name, g.formatExpr(x, vi))
+	}
+	if cond != "" {
+		g.printf("}\n")
+	}
+}
+
+// genElementEncode writes the element field, guarded tells that a non-repeated
+// pointer was already checked for nil
+func (g *generator) genElementEncode(f field, guarded bool) {
+	x := "v." + f.sel
+	vi := g.valueInfo(f.typ, true)
+	if vi.kind == vFallback {
+		g.printf("if err := w.WriteElement(%q, &%s); err != nil {\nreturn err\n}\n", f.name, x)
+		return
+	}
+	if vi.slice {
+		g.printf("for i := range %s {\n", x)
+		x += "[i]"
+	}
+	check := vi.ptr && (vi.slice || !guarded)
+	if check {
+		g.printf("if %s != nil {\n", x)
+	}
+	if vi.kind == vStruct {
+		g.printf("if err := %s.EncodeXG(w, %q); err != nil {\nreturn err\n}\n", x, f.name)
+	} else {
+		if vi.ptr {
+			x = "*" + x
+		}
+		g.printf("w.OTag(%q)\nw.String(%s)\nw.CTag()\n", f.name, g.formatExpr(x, vi))
+	}
+	if check {
+		g.printf("}\n")
+	}
+	if vi.slice {
+		g.printf("}\n")
+	}
+}
+
+func equalNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+// Command xg-gen generates reflection-free XML decoders and encoders for
+// tagged Go structs.
+//
+// Usage:
+//
+//	//go:generate xg-gen -type Config,Server
+//
+// For every listed type T, xg-gen writes two methods:
+//
+//	func (v *T) DecodeXG(ci *xg.Content) error      // decodes the current tag of ci
+//	func (v *T) EncodeXG(w *xg.Writer, name string) error // writes v as an element
+//
+// The methods follow the field tags exactly as the reflection path of
+// xg.Unmarshal and Writer.Write does. Fields of basic types, []byte and
+// other generated types are handled directly, fields of other types, such as
+// text marshalers and struct types without generated methods, are passed to
+// the reflection path.
+//
+// Some forms are not supported and make xg-gen fail: XMLName fields,
+// innerxml and any fields, interface fields, embedded struct pointers,
+// chardata fields of struct types, comment fields other than string and
+// []byte, and listed types that have their own MarshalXG, MarshalText or
+// similar codec methods.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of type names; must be set")
+	output    = flag.String("output", "", "output file name; default srcdir/<type>_xg.go")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of xg-gen:\n")
+	fmt.Fprintf(os.Stderr, "\txg-gen -type T[,T...] [-output file] [directory]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *typeNames == "" || flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+	names := strings.Split(*typeNames, ",")
+	outName := *output
+	if outName == "" {
+		outName = filepath.Join(dir, strings.ToLower(names[0])+"_xg.go")
+	}
+
+	src, err := generate(dir, names, filepath.Base(outName))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "xg-gen: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(outName, src, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "xg-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// generate type-checks the package in dir and returns the formatted source of
+// the generated file, an existing output file is ignored
+func generate(dir string, names []string, outName string) ([]byte, error) {
+	pkg, err := loadPackage(dir, outName)
+	if err != nil {
+		return nil, err
+	}
+	g := newGenerator(pkg)
+	for _, name := range names {
+		if err := g.addType(name); err != nil {
+			return nil, err
+		}
+	}
+	return g.generate("xg-gen -type " + strings.Join(names, ","))
+}
+
+func loadPackage(dir string, skip string) (*types.Package, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, fn := range matches {
+		base := filepath.Base(fn)
+		if base == skip || strings.HasSuffix(base, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, fn, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) > 0 && f.Name.Name != files[0].Name.Name {
+			return nil, fmt.Errorf("%s: multiple packages %s and %s", dir, files[0].Name.Name, f.Name.Name)
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no Go files", dir)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	return conf.Check(files[0].Name.Name, fset, files, nil)
+}
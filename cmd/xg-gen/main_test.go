@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGenerated checks that the committed output of internal/gentest is up
+// to date, its tests compare the generated code with the reflection path
+func TestGenerated(t *testing.T) {
+	dir := filepath.Join("..", "..", "internal", "gentest")
+	want, err := os.ReadFile(filepath.Join(dir, "config_xg.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := generate(dir, []string{"Config", "Server", "Point"}, "config_xg.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("config_xg.go is out of date, run go generate in %s", dir)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		err  string
+	}{
+		{"missing", `type T struct{}`, "type U not found"},
+		{"not struct", `type U int`, "U is not a struct type"},
+		{"xmlname", `type U struct { XMLName struct{} }`, "U: XMLName fields are not supported"},
+		{"any", "type U struct { A []string `xg:\",any\"` }", "U.A: innerxml and any fields are not supported"},
+		{"interface", "type U struct { A []interface{} `xg:\"a\"` }", "U.A: interface fields are not supported"},
+		{"chardata", "type U struct { A struct{} `xg:\",chardata\"` }", "U.A: unsupported type struct{}"},
+		{"tag", "type U struct { A int `xg:\"a,attr,chardata\"` }", `xg: invalid tag "a,attr,chardata" on field A: conflicting flags`},
+		{"method", "type U struct{}\nfunc (U) MarshalText() ([]byte, error) { return nil, nil }", "U has method MarshalText, it does not use field tags"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := "package p\n\n" + tt.src + "\n"
+			if err := os.WriteFile(filepath.Join(dir, "p.go"), []byte(src), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := generate(dir, []string{"U"}, "u_xg.go")
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v\nwant %s", err, tt.err)
+			}
+		})
+	}
+}
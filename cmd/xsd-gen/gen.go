@@ -0,0 +1,647 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"unicode"
+
+	xg "github.com/adnsv/xmlgo"
+)
+
+// builtins maps XML schema built-in types to Go types, types that are not
+// listed map to string
+var builtins = map[string]string{
+	"boolean":            "bool",
+	"float":              "float32",
+	"double":             "float64",
+	"decimal":            "float64",
+	"integer":            "int64",
+	"nonPositiveInteger": "int64",
+	"negativeInteger":    "int64",
+	"long":               "int64",
+	"int":                "int32",
+	"short":              "int16",
+	"byte":               "int8",
+	"nonNegativeInteger": "uint64",
+	"positiveInteger":    "uint64",
+	"unsignedLong":       "uint64",
+	"unsignedInt":        "uint32",
+	"unsignedShort":      "uint16",
+	"unsignedByte":       "uint8",
+}
+
+type goField struct {
+	name string // empty for embedded fields
+	typ  string
+	tag  string
+}
+
+// fieldSet collects the fields of a struct, keeping field names unique
+type fieldSet struct {
+	owner  string // Go name of the struct
+	fields []goField
+	used   map[string]bool
+}
+
+func (fs *fieldSet) add(name, typ, tag string) {
+	if name != "" {
+		base := name
+		for i := 2; fs.used[name]; i++ {
+			name = base + strconv.Itoa(i)
+		}
+		fs.used[name] = true
+	}
+	fs.fields = append(fs.fields, goField{name, typ, tag})
+}
+
+// typeRef is the Go type of an element or attribute
+type typeRef struct {
+	name   string
+	basic  string // underlying basic type, empty for structs
+	anon   bool   // declared inline, used by a single element
+	simple bool
+}
+
+type registration struct {
+	name   string // element name
+	goType string
+}
+
+type generator struct {
+	s   *schemaSet
+	pkg string
+	err error
+
+	used       map[string]bool     // package level identifiers
+	typeNames  map[*xg.Node]string // Go names of type declarations
+	pending    []*xg.Node          // anonymous types waiting to be written
+	alts       map[string]altType  // choice alternatives by element name
+	registered map[string]bool     // Go types of choice alternatives
+	regs       []registration      // alternatives in order of appearance
+	fmtUsed    bool
+	out        bytes.Buffer
+}
+
+type altType struct {
+	goType     string
+	underlying string
+}
+
+func newGenerator(s *schemaSet, pkg string) *generator {
+	return &generator{
+		s:          s,
+		pkg:        pkg,
+		used:       map[string]bool{"Registry": true},
+		typeNames:  map[*xg.Node]string{},
+		alts:       map[string]altType{},
+		registered: map[string]bool{},
+	}
+}
+
+func (g *generator) fail(format string, args ...interface{}) {
+	if g.err == nil {
+		g.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.out, format, args...)
+}
+
+// uniq returns an unused package level identifier based on name
+func (g *generator) uniq(name string) string {
+	base := name
+	for i := 2; g.used[name]; i++ {
+		name = base + strconv.Itoa(i)
+	}
+	g.used[name] = true
+	return name
+}
+
+// goName converts an XML name to an exported Go identifier
+func goName(s string) string {
+	name := camel(s)
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		name = "X" + name
+	}
+	return name
+}
+
+// camel capitalizes the alphanumeric runs of s, dropping other characters
+func camel(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// generate returns the formatted source of the generated file
+func (g *generator) generate(cmd string) ([]byte, error) {
+	// name the global types first, so that they keep their names when
+	// anonymous types collide with them
+	for _, d := range g.s.decls {
+		name, _ := d.Attr("name")
+		switch d.LocalName() {
+		case "simpleType", "complexType":
+			g.typeNames[d] = g.uniq(goName(name))
+		}
+	}
+	for _, d := range g.s.decls {
+		name, _ := d.Attr("name")
+		if d.LocalName() != "element" {
+			continue
+		}
+		if t := child(d, "complexType"); t != nil {
+			g.typeNames[t] = g.uniq(goName(name))
+		} else if t := child(d, "simpleType"); t != nil {
+			g.typeNames[t] = g.uniq(goName(name))
+		}
+	}
+
+	for _, d := range g.s.decls {
+		switch d.LocalName() {
+		case "simpleType":
+			g.simpleType(d)
+		case "complexType":
+			g.complexType(d)
+		case "element":
+			if t := child(d, "complexType"); t != nil {
+				g.complexType(t)
+			} else if t := child(d, "simpleType"); t != nil {
+				g.simpleType(t)
+			}
+		default:
+			continue
+		}
+		for len(g.pending) > 0 {
+			t := g.pending[0]
+			g.pending = g.pending[1:]
+			if t.LocalName() == "simpleType" {
+				g.simpleType(t)
+			} else {
+				g.complexType(t)
+			}
+		}
+	}
+	for _, d := range g.s.decls {
+		if d.LocalName() == "element" {
+			g.rootFuncs(d)
+		}
+	}
+	g.registry()
+	if g.err != nil {
+		return nil, g.err
+	}
+
+	body := g.out.Bytes()
+	var head bytes.Buffer
+	fmt.Fprintf(&head, "// Code generated by %s; DO NOT EDIT.\n\n", cmd)
+	fmt.Fprintf(&head, "package %s\n\n", g.pkg)
+	head.WriteString("import (\n")
+	if g.fmtUsed {
+		head.WriteString("\t\"fmt\"\n\n")
+	}
+	head.WriteString("\txg \"github.com/adnsv/xmlgo\"\n)\n\n")
+	src, err := format.Source(append(head.Bytes(), body...))
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v", err)
+	}
+	return src, nil
+}
+
+// comment writes the documentation of a schema component as a Go comment
+func (g *generator) comment(n *xg.Node) {
+	words := strings.Fields(documentation(n))
+	line := "//"
+	for _, w := range words {
+		if len(line)+1+len(w) > 78 && line != "//" {
+			g.printf("%s\n", line)
+			line = "//"
+		}
+		line += " " + w
+	}
+	if line != "//" {
+		g.printf("%s\n", line)
+	}
+}
+
+// typeName returns the Go name of an anonymous type declaration, naming and
+// queueing it on first use
+func (g *generator) typeName(t *xg.Node, name string) string {
+	if s, ok := g.typeNames[t]; ok {
+		return s
+	}
+	s := g.uniq(name)
+	g.typeNames[t] = s
+	g.pending = append(g.pending, t)
+	return s
+}
+
+// typeOf resolves a type reference
+func (g *generator) typeOf(n *xg.Node, qname string) typeRef {
+	uri, local := resolveQName(n, qname)
+	if uri == xsdNS {
+		if t, ok := builtins[local]; ok {
+			return typeRef{name: t, basic: t, simple: true}
+		}
+		return typeRef{name: "string", basic: "string", simple: true}
+	}
+	if t, ok := g.s.simpleTypes[local]; ok {
+		return typeRef{name: g.typeNames[t], basic: g.simpleBasic(t), simple: true}
+	}
+	if t, ok := g.s.complexTypes[local]; ok {
+		return typeRef{name: g.typeNames[t]}
+	}
+	g.fail("unknown type %q", qname)
+	return typeRef{name: "string", basic: "string", simple: true}
+}
+
+// simpleBasic returns the basic Go type of a simple type declaration
+func (g *generator) simpleBasic(t *xg.Node) string {
+	r := child(t, "restriction")
+	if r == nil {
+		return "string" // list or union
+	}
+	if base, ok := r.Attr("base"); ok {
+		return g.typeOf(r, base).basic
+	}
+	if st := child(r, "simpleType"); st != nil {
+		return g.simpleBasic(st)
+	}
+	return "string"
+}
+
+func (g *generator) simpleType(t *xg.Node) {
+	name := g.typeNames[t]
+	basic := g.simpleBasic(t)
+	g.comment(t)
+	g.printf("type %s %s\n\n", name, basic)
+
+	r := child(t, "restriction")
+	if r == nil {
+		return
+	}
+	var consts []string
+	for _, e := range xsdElements(r) {
+		if e.LocalName() != "enumeration" {
+			continue
+		}
+		v, _ := e.Attr("value")
+		lit := v
+		switch basic {
+		case "string":
+			lit = strconv.Quote(v)
+		case "bool":
+			if v != "true" && v != "false" {
+				g.fail("invalid enumeration value %q of type %s", v, name)
+			}
+		default:
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				g.fail("invalid enumeration value %q of type %s", v, name)
+			}
+		}
+		c := g.uniq(name + camel(v))
+		consts = append(consts, c)
+		if len(consts) == 1 {
+			g.printf("const (\n")
+		}
+		g.comment(e)
+		g.printf("%s %s = %s\n", c, name, lit)
+	}
+	if len(consts) == 0 {
+		return
+	}
+	g.printf(")\n\n")
+	g.printf("// Valid reports whether v is one of the enumerated values\n")
+	g.printf("func (v %s) Valid() bool {\nswitch v {\ncase %s:\nreturn true\n}\nreturn false\n}\n\n", name, strings.Join(consts, ", "))
+	g.fmtUsed = true
+	g.printf("func (v *%s) UnmarshalText(b []byte) error {\n", name)
+	if basic == "string" {
+		g.printf("if !%s(b).Valid() {\nreturn fmt.Errorf(\"invalid %s %%q\", b)\n}\n", name, name)
+		g.printf("*v = %s(b)\nreturn nil\n}\n\n", name)
+		return
+	}
+	g.printf("x, err := %s\n", parseCall(basic))
+	g.printf("if err != nil || !%s(x).Valid() {\nreturn fmt.Errorf(\"invalid %s %%q\", b)\n}\n", name, name)
+	g.printf("*v = %s(x)\nreturn nil\n}\n\n", name)
+}
+
+// parseCall returns the call that parses b into a value of a basic type
+func parseCall(basic string) string {
+	switch basic {
+	case "bool":
+		return "xg.ParseBool(string(b))"
+	case "float32", "float64":
+		return "xg.ParseFloat(string(b), " + basic[5:] + ")"
+	case "uint8", "uint16", "uint32", "uint64":
+		return "xg.ParseUint(string(b), " + basic[4:] + ")"
+	}
+	return "xg.ParseInt(string(b), " + basic[3:] + ")"
+}
+
+func (g *generator) complexType(t *xg.Node) {
+	name := g.typeNames[t]
+	fs := &fieldSet{owner: name, used: map[string]bool{}}
+	g.content(fs, t)
+	if mixed, _ := t.Attr("mixed"); mixed == "true" {
+		g.addText(fs)
+	}
+
+	g.comment(t)
+	g.printf("type %s struct {\n", name)
+	for _, f := range fs.fields {
+		if f.name == "" {
+			g.printf("%s\n", f.typ)
+		} else {
+			g.printf("%s %s `xg:%q`\n", f.name, f.typ, f.tag)
+		}
+	}
+	g.printf("}\n\n")
+}
+
+// addText adds a character data field for mixed content
+func (g *generator) addText(fs *fieldSet) {
+	for _, f := range fs.fields {
+		if f.tag == ",chardata" {
+			return
+		}
+	}
+	fs.add("Text", "string", ",chardata")
+}
+
+// content adds the fields of a complex type or of an extension
+func (g *generator) content(fs *fieldSet, n *xg.Node) {
+	for _, c := range xsdElements(n) {
+		switch c.LocalName() {
+		case "sequence", "all", "choice", "group":
+			g.particle(fs, c, false, false)
+		case "attribute":
+			g.attribute(fs, c)
+		case "attributeGroup":
+			g.attributeGroup(fs, c)
+		case "simpleContent":
+			for _, d := range xsdElements(c) {
+				if base, ok := d.Attr("base"); ok {
+					if t := g.typeOf(d, base); t.simple {
+						fs.add("Value", t.name, ",chardata")
+					} else {
+						fs.add("", t.name, "")
+					}
+				}
+				g.content(fs, d)
+			}
+		case "complexContent":
+			for _, d := range xsdElements(c) {
+				if base, ok := d.Attr("base"); ok && d.LocalName() == "extension" {
+					if t := g.typeOf(d, base); !t.simple {
+						fs.add("", t.name, "")
+					}
+				}
+				g.content(fs, d)
+			}
+			if mixed, _ := c.Attr("mixed"); mixed == "true" {
+				g.addText(fs)
+			}
+		}
+	}
+}
+
+// particle adds the fields of an element or a model group, rep and opt are
+// inherited from enclosing groups
+func (g *generator) particle(fs *fieldSet, n *xg.Node, rep, opt bool) {
+	min, max := occurs(n)
+	rep = rep || max != 1
+	opt = opt || min == 0
+	switch n.LocalName() {
+	case "element":
+		g.elementField(fs, n, rep, opt)
+	case "sequence", "all":
+		for _, c := range xsdElements(n) {
+			g.particle(fs, c, rep, opt)
+		}
+	case "choice":
+		g.choiceField(fs, n, rep)
+	case "group":
+		ref, _ := n.Attr("ref")
+		_, local := resolveQName(n, ref)
+		grp, ok := g.s.groups[local]
+		if !ok {
+			g.fail("unknown group %q", ref)
+			return
+		}
+		for _, c := range xsdElements(grp) {
+			g.particle(fs, c, rep, opt)
+		}
+	}
+}
+
+// elementName returns the XML name of an element declaration or reference
+func elementName(el *xg.Node) string {
+	if ref, ok := el.Attr("ref"); ok {
+		_, local := resolveQName(el, ref)
+		return local
+	}
+	name, _ := el.Attr("name")
+	return name
+}
+
+// elementType returns the type of an element declaration or reference
+func (g *generator) elementType(owner string, el *xg.Node) typeRef {
+	if ref, ok := el.Attr("ref"); ok {
+		_, local := resolveQName(el, ref)
+		global, ok := g.s.elements[local]
+		if !ok {
+			g.fail("unknown element %q", ref)
+			return typeRef{name: "string", basic: "string", simple: true}
+		}
+		return g.elementType("", global)
+	}
+	if typ, ok := el.Attr("type"); ok {
+		return g.typeOf(el, typ)
+	}
+	name := owner + goName(elementName(el))
+	if t := child(el, "complexType"); t != nil {
+		return typeRef{name: g.typeName(t, name), anon: true}
+	}
+	if t := child(el, "simpleType"); t != nil {
+		return typeRef{name: g.typeName(t, name), basic: g.simpleBasic(t), anon: true, simple: true}
+	}
+	return typeRef{name: "string", basic: "string", simple: true}
+}
+
+// fieldType applies repetition and optionality, optional values that have no
+// empty representation become pointers
+func fieldType(t typeRef, rep, opt bool) (typ string, omitEmpty bool) {
+	switch {
+	case rep:
+		return "[]" + t.name, false
+	case !opt:
+		return t.name, false
+	case t.basic == "string":
+		return t.name, true
+	}
+	return "*" + t.name, false
+}
+
+func (g *generator) elementField(fs *fieldSet, el *xg.Node, rep, opt bool) {
+	name := elementName(el)
+	typ, omitEmpty := fieldType(g.elementType(fs.owner, el), rep, opt)
+	tag := name
+	if omitEmpty {
+		tag += ",omitempty"
+	}
+	fs.add(goName(name), typ, tag)
+}
+
+func (g *generator) choiceField(fs *fieldSet, n *xg.Node, rep bool) {
+	iface := g.uniq(fs.owner + "Choice")
+	var alts []string
+	first := ""
+	for _, c := range xsdElements(n) {
+		switch c.LocalName() {
+		case "element":
+			if first == "" {
+				first = elementName(c)
+			}
+			alt := g.altType(fs.owner, c)
+			alts = append(alts, alt)
+		case "any":
+		default:
+			g.fail("choice in %s: only element alternatives are supported", fs.owner)
+		}
+	}
+	if first == "" {
+		return
+	}
+	g.printf("// %s is one of %s\n", iface, strings.Join(alts, ", "))
+	g.printf("type %s interface {\nis%s()\n}\n\n", iface, iface)
+	for _, alt := range alts {
+		g.printf("func (%s) is%s() {}\n", alt, iface)
+	}
+	g.printf("\n")
+
+	typ := iface
+	if rep {
+		typ = "[]" + iface
+	}
+	fs.add("Choice", typ, first)
+}
+
+// altType returns the Go type of a choice alternative. Alternatives need
+// distinct types to be registered by element name.
+func (g *generator) altType(owner string, el *xg.Node) string {
+	name := elementName(el)
+	t := g.elementType(owner, el)
+	if a, ok := g.alts[name]; ok {
+		if a.underlying != t.name {
+			g.fail("element %q appears in choices with different types", name)
+		}
+		return a.goType
+	}
+	a := altType{goType: t.name, underlying: t.name}
+	if t.basic == t.name || g.registered[t.name] {
+		// builtin types, and types registered for other elements, need a
+		// type of their own
+		a.goType = g.uniq(goName(name))
+		g.printf("type %s %s\n\n", a.goType, t.name)
+	}
+	g.registered[a.goType] = true
+	g.alts[name] = a
+	g.regs = append(g.regs, registration{name, a.goType})
+	return a.goType
+}
+
+func (g *generator) attribute(fs *fieldSet, a *xg.Node) {
+	use, _ := a.Attr("use")
+	if use == "prohibited" {
+		return
+	}
+	name, _ := a.Attr("name")
+	t := typeRef{name: "string", basic: "string", simple: true}
+	if ref, ok := a.Attr("ref"); ok {
+		name = ref
+		uri, local := resolveQName(a, ref)
+		if global, ok := g.s.attributes[local]; ok && uri != xmlNS {
+			a = global
+		}
+	}
+	if typ, ok := a.Attr("type"); ok {
+		t = g.typeOf(a, typ)
+	} else if st := child(a, "simpleType"); st != nil {
+		t = typeRef{name: g.typeName(st, fs.owner+goName(name)), basic: g.simpleBasic(st), simple: true}
+	}
+	typ, omitEmpty := fieldType(t, false, use != "required")
+	tag := name + ",attr"
+	if omitEmpty {
+		tag += ",omitempty"
+	}
+	_, local := resolveQName(a, name)
+	fs.add(goName(local), typ, tag)
+}
+
+func (g *generator) attributeGroup(fs *fieldSet, n *xg.Node) {
+	ref, _ := n.Attr("ref")
+	_, local := resolveQName(n, ref)
+	grp, ok := g.s.attrGroups[local]
+	if !ok {
+		g.fail("unknown attribute group %q", ref)
+		return
+	}
+	for _, c := range xsdElements(grp) {
+		switch c.LocalName() {
+		case "attribute":
+			g.attribute(fs, c)
+		case "attributeGroup":
+			g.attributeGroup(fs, c)
+		}
+	}
+}
+
+// rootFuncs writes the functions that read and write documents with the
+// global element as root
+func (g *generator) rootFuncs(el *xg.Node) {
+	name := elementName(el)
+	t := g.elementType("", el)
+	decode, encode := g.uniq("Decode"+goName(name)), g.uniq("Encode"+goName(name))
+
+	g.printf("// %s decodes a document with the <%s> root element\n", decode, name)
+	g.printf("func %s(buf string) (*%s, error) {\n", decode, t.name)
+	g.printf("ci := xg.Open(buf)\nci.SetRegistry(Registry)\nv := new(%s)\n", t.name)
+	g.printf("if err := ci.Decode(v); err != nil {\nreturn nil, err\n}\nreturn v, nil\n}\n\n")
+
+	g.printf("// %s writes v as the <%s> root element\n", encode, name)
+	g.printf("// and returns the first error of w\n")
+	g.printf("func %s(w *xg.Writer, v *%s) error {\n", encode, t.name)
+	g.printf("w.SetRegistry(Registry)\nw.OTag(%q)\n", name)
+	if g.s.targetNS != "" {
+		g.printf("w.StringAttr(\"xmlns\", %q)\n", g.s.targetNS)
+	}
+	g.printf("w.Write(v)\nw.CTag()\nreturn w.Err()\n}\n\n")
+}
+
+// registry writes the registry of choice alternatives
+func (g *generator) registry() {
+	g.printf("// Registry maps the elements of choices to their Go types\n")
+	g.printf("var Registry = xg.NewTypeRegistry()\n\n")
+	if len(g.regs) == 0 {
+		return
+	}
+	g.printf("func init() {\n")
+	for _, r := range g.regs {
+		g.printf("Registry.Register(%q, (*%s)(nil))\n", r.name, r.goType)
+	}
+	g.printf("}\n")
+}
@@ -0,0 +1,72 @@
+// Command xsd-gen compiles XML schemas into Go types that are read and
+// written with package xg.
+//
+// Usage:
+//
+//	xsd-gen -pkg name [-o file] schema.xsd...
+//
+// Named and anonymous complex types become structs, attributes and the
+// elements of sequences become fields. Simple types become named Go types,
+// restrictions with enumerations become typed enums with constants that
+// reject other values when decoding. Choice groups become interfaces, their
+// alternatives are registered by element name in the generated Registry. For
+// each global element, Decode<Element> and Encode<Element> functions read and
+// write documents with that root.
+//
+// Wildcards (any, anyAttribute), identity constraints and facets other than
+// enumerations are ignored. Included and imported schemas with a
+// schemaLocation are loaded as well, types are resolved by local name.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	pkgName = flag.String("pkg", "", "package name of the generated file; must be set")
+	output  = flag.String("o", "", "output file name; default is standard output")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of xsd-gen:\n")
+	fmt.Fprintf(os.Stderr, "\txsd-gen -pkg name [-o file] schema.xsd...\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *pkgName == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	args := []string{"xsd-gen", "-pkg", *pkgName}
+	for _, fn := range flag.Args() {
+		args = append(args, filepath.ToSlash(fn))
+	}
+
+	s := newSchemaSet()
+	for _, fn := range flag.Args() {
+		if err := s.load(fn); err != nil {
+			fmt.Fprintf(os.Stderr, "xsd-gen: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	src, err := newGenerator(s, *pkgName).generate(strings.Join(args, " "))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "xsd-gen: %v\n", err)
+		os.Exit(1)
+	}
+	if *output == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := os.WriteFile(*output, src, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "xsd-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
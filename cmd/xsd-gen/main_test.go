@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGenerated checks that the committed output of internal/xsdtest is up
+// to date, its tests decode and encode documents with the generated types
+func TestGenerated(t *testing.T) {
+	dir := filepath.Join("..", "..", "internal", "xsdtest")
+	want, err := os.ReadFile(filepath.Join(dir, "schema_xsd.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSchemaSet()
+	if err := s.load(filepath.Join(dir, "schema.xsd")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := newGenerator(s, "xsdtest").generate("xsd-gen -pkg xsdtest schema.xsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("schema_xsd.go is out of date, run go generate in %s", dir)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		err  string
+	}{
+		{"not schema", `<schema/>`, "not an XML schema"},
+		{"duplicate", `<xs:simpleType name="a"/><xs:simpleType name="a"/>`, `duplicate simpleType "a"`},
+		{"type", `<xs:element name="a" type="b"/>`, `unknown type "b"`},
+		{"ref", `<xs:complexType name="a"><xs:sequence><xs:element ref="b"/></xs:sequence></xs:complexType>`, `unknown element "b"`},
+		{"group", `<xs:complexType name="a"><xs:group ref="b"/></xs:complexType>`, `unknown group "b"`},
+		{"enum", `<xs:simpleType name="a"><xs:restriction base="xs:int"><xs:enumeration value="x"/></xs:restriction></xs:simpleType>`,
+			`invalid enumeration value "x" of type A`},
+		{"choice", `<xs:complexType name="a"><xs:choice><xs:sequence/></xs:choice></xs:complexType>`,
+			"choice in A: only element alternatives are supported"},
+		{"alternatives", `<xs:complexType name="a"><xs:choice><xs:element name="b" type="xs:int"/><xs:element name="c"/></xs:choice></xs:complexType>
+			<xs:complexType name="d"><xs:choice><xs:element name="b" type="xs:string"/></xs:choice></xs:complexType>`,
+			`element "b" appears in choices with different types`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := tt.src
+			if !strings.HasPrefix(tt.src, "<schema") {
+				src = `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">` + tt.src + `</xs:schema>`
+			}
+			s := newSchemaSet()
+			err := s.add("t.xsd", src)
+			if err == nil {
+				_, err = newGenerator(s, "p").generate("xsd-gen")
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v\nwant %s", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	xg "github.com/adnsv/xmlgo"
+)
+
+const (
+	xsdNS = "http://www.w3.org/2001/XMLSchema"
+	xmlNS = "http://www.w3.org/XML/1998/namespace"
+)
+
+// schemaSet holds the global declarations of the loaded schemas, keyed by
+// local name
+type schemaSet struct {
+	loaded       map[string]bool
+	targetNS     string // namespace of the first schema
+	decls        []*xg.Node
+	simpleTypes  map[string]*xg.Node
+	complexTypes map[string]*xg.Node
+	elements     map[string]*xg.Node
+	attributes   map[string]*xg.Node
+	groups       map[string]*xg.Node
+	attrGroups   map[string]*xg.Node
+}
+
+func newSchemaSet() *schemaSet {
+	return &schemaSet{
+		loaded:       map[string]bool{},
+		simpleTypes:  map[string]*xg.Node{},
+		complexTypes: map[string]*xg.Node{},
+		elements:     map[string]*xg.Node{},
+		attributes:   map[string]*xg.Node{},
+		groups:       map[string]*xg.Node{},
+		attrGroups:   map[string]*xg.Node{},
+	}
+}
+
+// load reads the schema file along with the schemas it includes or imports
+func (s *schemaSet) load(fn string) error {
+	abs, err := filepath.Abs(fn)
+	if err != nil {
+		return err
+	}
+	if s.loaded[abs] {
+		return nil
+	}
+	s.loaded[abs] = true
+	buf, err := os.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+	return s.add(fn, string(buf))
+}
+
+// add registers the global declarations of a schema document, fn locates
+// included schemas
+func (s *schemaSet) add(fn string, buf string) error {
+	doc, err := xg.ParseDocument(buf)
+	if err != nil {
+		return fmt.Errorf("%s: %v", fn, err)
+	}
+	root := doc.Root()
+	if root == nil || !isXSD(root, "schema") {
+		return fmt.Errorf("%s: not an XML schema", fn)
+	}
+	if len(s.decls) == 0 {
+		s.targetNS, _ = root.Attr("targetNamespace")
+	}
+	for _, n := range xsdElements(root) {
+		name, _ := n.Attr("name")
+		var m map[string]*xg.Node
+		switch n.LocalName() {
+		case "include", "import", "redefine":
+			if loc, ok := n.Attr("schemaLocation"); ok {
+				if err := s.load(filepath.Join(filepath.Dir(fn), filepath.FromSlash(loc))); err != nil {
+					return err
+				}
+			}
+			continue
+		case "simpleType":
+			m = s.simpleTypes
+		case "complexType":
+			m = s.complexTypes
+		case "element":
+			m = s.elements
+		case "attribute":
+			m = s.attributes
+		case "group":
+			m = s.groups
+		case "attributeGroup":
+			m = s.attrGroups
+		default:
+			continue
+		}
+		if _, dup := m[name]; dup {
+			return fmt.Errorf("%s: duplicate %s %q", fn, n.LocalName(), name)
+		}
+		m[name] = n
+		s.decls = append(s.decls, n)
+	}
+	return nil
+}
+
+// isXSD reports whether n is the named element of the schema namespace
+func isXSD(n *xg.Node, local string) bool {
+	return n.Kind == xg.ElementNode && n.LocalName() == local && n.NamespaceURI() == xsdNS
+}
+
+// xsdElements returns the child elements of the schema namespace, skipping
+// annotations
+func xsdElements(n *xg.Node) []*xg.Node {
+	var ret []*xg.Node
+	for _, c := range n.Elements() {
+		if c.NamespaceURI() == xsdNS && c.LocalName() != "annotation" {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+// child returns the first child with the local name
+func child(n *xg.Node, local string) *xg.Node {
+	for _, c := range n.Elements() {
+		if isXSD(c, local) {
+			return c
+		}
+	}
+	return nil
+}
+
+// resolveQName splits a QName attribute value into namespace URI and local
+// name, using the namespace declarations in scope of n
+func resolveQName(n *xg.Node, qname string) (uri, local string) {
+	prefix := ""
+	local = qname
+	for i := 0; i < len(qname); i++ {
+		if qname[i] == ':' {
+			prefix, local = qname[:i], qname[i+1:]
+			break
+		}
+	}
+	uri, _ = n.LookupNamespace(prefix)
+	return uri, local
+}
+
+// occurs returns the minOccurs and maxOccurs of a particle, unbounded is -1
+func occurs(n *xg.Node) (min, max int) {
+	min, max = 1, 1
+	if s, ok := n.Attr("minOccurs"); ok {
+		min, _ = strconv.Atoi(s)
+	}
+	if s, ok := n.Attr("maxOccurs"); ok {
+		if s == "unbounded" {
+			max = -1
+		} else {
+			max, _ = strconv.Atoi(s)
+		}
+	}
+	return min, max
+}
+
+// documentation returns the text of the first documentation annotation
+func documentation(n *xg.Node) string {
+	if a := child(n, "annotation"); a != nil {
+		if d := child(a, "documentation"); d != nil {
+			return d.Text()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package xg
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// The functions in this file support the code generated by cmd/xg-gen. The
+// generated code decodes and encodes basic values directly and uses these
+// helpers to produce the same results and errors as the reflection path.
+
+// Token returns the current token
+func (ci *Content) Token() *Token {
+	if ci == nil {
+		return nil
+	}
+	return ci.t
+}
+
+// TagPath returns the path of the current tag, it is the path of the content
+// passed to HandleTag callbacks
+func (ci *Content) TagPath() string {
+	if ci == nil || ci.t == nil {
+		return ci.Path()
+	}
+	return ci.childPath(ci.t.Name, ci.tagIndex)
+}
+
+// CharData collects the character data of the remaining content, child
+// elements are skipped. The offset locates the first text token, it is -1
+// when there is no text.
+func (ci *Content) CharData() (s string, offset int, err error) {
+	var sb strings.Builder
+	offset = -1
+	for ci.Next() {
+		switch ci.Kind() {
+		case SData, CData:
+			if offset < 0 {
+				offset = ci.t.SrcPos
+			}
+			sb.WriteString(ci.text())
+		}
+	}
+	return sb.String(), offset, ci.Err()
+}
+
+// DecodeText decodes character data into v, which must be a non-nil pointer.
+// Errors are located at the offset, a negative offset refers to the current
+// position.
+func (ci *Content) DecodeText(offset int, s string, v interface{}) error {
+	return setValue(ci, offset, reflect.ValueOf(v).Elem(), s)
+}
+
+// DecodeAttr decodes the named attribute of the element at path into v, which
+// must be a non-nil pointer. Missing attributes leave v unchanged.
+func (ci *Content) DecodeAttr(attrs AttributeList, name, path string, v interface{}) error {
+	return ci.decodeAttr(attrs, name, reflect.ValueOf(v).Elem(), func() string { return path })
+}
+
+// MarkNamespaces marks namespace declarations as handled
+func (aa AttributeList) MarkNamespaces() {
+	for _, a := range aa {
+		if a.Name == "xmlns" || strings.HasPrefix(string(a.Name), "xmlns:") {
+			a.handled = true
+		}
+	}
+}
+
+// WriteElement writes v wrapped into an element, slices produce one element
+// per item and nil values produce nothing. Errors are recorded as well, see
+// Writer.Err.
+func (w *Writer) WriteElement(name string, v interface{}) error {
+	if w.err == nil {
+		w.fail(marshalElement(w, name, reflect.ValueOf(v), false))
+	}
+	return w.err
+}
+
+// ParseInt parses decimal character data, surrounding white space is ignored
+// and empty text is zero
+func ParseInt(s string, bits int) (int64, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, 10, bits)
+}
+
+// ParseUint is the unsigned version of ParseInt
+func ParseUint(s string, bits int) (uint64, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(s, 10, bits)
+}
+
+// ParseFloat parses character data, surrounding white space is ignored and
+// empty text is zero
+func ParseFloat(s string, bits int) (float64, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, bits)
+}
+
+// ParseBool parses character data, surrounding white space is ignored and
+// empty text is false
+func ParseBool(s string) (bool, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
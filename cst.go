@@ -0,0 +1,505 @@
+package xg
+
+import (
+	"io"
+	"strings"
+)
+
+// CSTNode is a node of a concrete syntax tree that keeps every byte of the
+// source document, including whitespace inside tags, quote styles and
+// entity spelling. Writing an unmodified tree reproduces the source exactly,
+// edits only touch the markup of the modified nodes.
+type CSTNode struct {
+	Kind NodeKind
+	Name NameString // element name or PI target
+	Lead string     // whitespace before the node markup (prolog and epilog)
+	Raw  string     // source markup, for elements: the "<name" part
+
+	// element only
+	Attrs  []*CSTAttr
+	TagEnd string // whitespace and ">" or "/>" that finish the opening tag
+	EndTag string // closing tag, empty for empty-element tags
+
+	// document only
+	Trail string // whitespace after the last node
+
+	Parent      *CSTNode
+	FirstChild  *CSTNode
+	LastChild   *CSTNode
+	PrevSibling *CSTNode
+	NextSibling *CSTNode
+
+	SrcPos int // offset of Raw in the source, -1 for created nodes
+}
+
+// CSTAttr is an attribute of a CST element
+type CSTAttr struct {
+	Lead string // whitespace before the attribute name
+	Name NameString
+	Raw  string // name="value" as written in the source
+}
+
+// ParseCST builds a concrete syntax tree from the document buffer
+func ParseCST(buf string) (*CSTNode, error) {
+	doc := &CSTNode{Kind: DocumentNode, SrcPos: 0}
+	tt := &tokenizer{buf: buf}
+	cur := doc
+	for {
+		t := tt.Next()
+		switch t.Kind {
+		case Err:
+			return nil, t.Error
+		case EOF:
+			doc.Trail = t.WhitePrefix
+			return doc, nil
+		case Tag:
+			lead, raw, pos := splitLead(t)
+			e := &CSTNode{Kind: ElementNode, Name: t.Name, Lead: lead, Raw: raw, SrcPos: pos}
+			cur.AppendChild(e)
+			cur = e
+		case Attrib:
+			cur.Attrs = append(cur.Attrs, &CSTAttr{Lead: t.WhitePrefix, Name: t.Name, Raw: t.Raw})
+		case BeginContent:
+			cur.TagEnd = t.WhitePrefix + t.Raw
+		case CloseEmptyTag:
+			cur.TagEnd = t.WhitePrefix + t.Raw
+			cur = cur.Parent
+		case EndContent:
+			cur.EndTag = t.WhitePrefix + t.Raw
+			cur = cur.Parent
+		case SData:
+			cur.AppendChild(&CSTNode{Kind: TextNode, Raw: t.Raw, SrcPos: t.SrcPos})
+		default:
+			lead, raw, pos := splitLead(t)
+			cur.AppendChild(&CSTNode{Kind: cstKind(t.Kind), Name: t.Name, Lead: lead, Raw: raw, SrcPos: pos})
+		}
+	}
+}
+
+// splitLead moves the byte order mark and the whitespace that follows it
+// from the markup of the first token to its lead
+func splitLead(t *Token) (lead, raw string, pos int) {
+	i := strings.IndexByte(t.Raw, '<')
+	if i <= 0 {
+		return t.WhitePrefix, t.Raw, t.SrcPos
+	}
+	return t.WhitePrefix + t.Raw[:i], t.Raw[i:], t.SrcPos + i
+}
+
+// ParseCSTElement parses a single element fragment, the result can be
+// inserted into another tree
+func ParseCSTElement(s string) (*CSTNode, error) {
+	doc, err := ParseCST(s)
+	if err != nil {
+		return nil, err
+	}
+	root := doc.Root()
+	if root == nil {
+		return nil, NewError(ErrCodeMissingRoot, s, len(s))
+	}
+	doc.RemoveChild(root)
+	root.Lead = ""
+	return root, nil
+}
+
+func cstKind(k TokenKind) NodeKind {
+	switch k {
+	case CData:
+		return CDataNode
+	case Comment:
+		return CommentNode
+	case PI:
+		return PINode
+	case XmlDecl:
+		return DeclNode
+	case DocTypeDecl:
+		return DocTypeNode
+	}
+	panic("xml cst: unexpected token " + k.String())
+}
+
+// NewCSTElement creates an empty element node
+func NewCSTElement(name NameString) *CSTNode {
+	return &CSTNode{Kind: ElementNode, Name: name, Raw: "<" + string(name), TagEnd: " />", SrcPos: -1}
+}
+
+// NewCSTText creates a text node, s is escaped as needed
+func NewCSTText(s string) *CSTNode {
+	return &CSTNode{Kind: TextNode, Raw: escapeCST(s, 0), SrcPos: -1}
+}
+
+// NewCSTComment creates a comment node, the dashes of -- are separated and a
+// trailing - is padded with a space as with Writer.Comment
+func NewCSTComment(s string) *CSTNode {
+	return &CSTNode{Kind: CommentNode, Raw: "<!--" + padComment(s) + "-->", SrcPos: -1}
+}
+
+// escapeCST escapes markup characters, attribute values also escape the
+// quote character and whitespace that would be normalized by parsers
+func escapeCST(s string, quote byte) string {
+	sb := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '&':
+			sb.WriteString("&amp;")
+		case c == '<':
+			sb.WriteString("&lt;")
+		case c == '>' && quote == 0:
+			sb.WriteString("&gt;")
+		case c == '"' && quote == '"':
+			sb.WriteString("&quot;")
+		case c == '\'' && quote == '\'':
+			sb.WriteString("&apos;")
+		case quote != 0 && c == '\t':
+			sb.WriteString("&#9;")
+		case quote != 0 && c == '\n':
+			sb.WriteString("&#10;")
+		case quote != 0 && c == '\r':
+			sb.WriteString("&#13;")
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// String returns the source text of the node and its descendants, including
+// the lead of the node
+func (n *CSTNode) String() string {
+	sb := &strings.Builder{}
+	n.WriteTo(sb)
+	return sb.String()
+}
+
+// WriteTo writes the source text of the node and its descendants
+func (n *CSTNode) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	n.write(cw)
+	return cw.n, cw.err
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) put(s string) {
+	if cw.err != nil || s == "" {
+		return
+	}
+	n, err := io.WriteString(cw.w, s)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+func (n *CSTNode) write(cw *countingWriter) {
+	cw.put(n.Lead)
+	cw.put(n.Raw)
+	if n.Kind == ElementNode {
+		for _, a := range n.Attrs {
+			cw.put(a.Lead)
+			cw.put(a.Raw)
+		}
+		cw.put(n.TagEnd)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		c.write(cw)
+	}
+	cw.put(n.EndTag)
+	cw.put(n.Trail)
+}
+
+// Root returns the document element
+func (n *CSTNode) Root() *CSTNode {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Kind == ElementNode {
+			return c
+		}
+	}
+	return nil
+}
+
+// Elements returns child elements, optionally filtered by name
+func (n *CSTNode) Elements(name ...NameString) []*CSTNode {
+	var ret []*CSTNode
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Kind != ElementNode {
+			continue
+		}
+		if len(name) == 0 {
+			ret = append(ret, c)
+			continue
+		}
+		for _, nm := range name {
+			if c.Name == nm {
+				ret = append(ret, c)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// Value returns the decoded content of a text, CDATA, comment or PI node
+func (n *CSTNode) Value() string {
+	switch n.Kind {
+	case TextNode:
+		return unscramble(n.Raw)
+	case CDataNode:
+		return n.Raw[len("<![CDATA[") : len(n.Raw)-len("]]>")]
+	case CommentNode:
+		return n.Raw[len("<!--") : len(n.Raw)-len("-->")]
+	case PINode:
+		s := n.Raw[len("<?")+len(n.Name) : len(n.Raw)-len("?>")]
+		return strings.TrimLeft(s, " \t\r\n")
+	}
+	return ""
+}
+
+// Text returns the concatenated text and CDATA content of the descendants
+func (n *CSTNode) Text() string {
+	if n.Kind == TextNode || n.Kind == CDataNode {
+		return n.Value()
+	}
+	sb := strings.Builder{}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Kind == TextNode || c.Kind == CDataNode || c.Kind == ElementNode {
+			sb.WriteString(c.Text())
+		}
+	}
+	return sb.String()
+}
+
+// SetText replaces the content of a text node, or all children of an element
+// with a single text node
+func (n *CSTNode) SetText(s string) {
+	switch n.Kind {
+	case TextNode:
+		n.Raw = escapeCST(s, 0)
+	case ElementNode:
+		for n.FirstChild != nil {
+			n.RemoveChild(n.FirstChild)
+		}
+		n.AppendChild(NewCSTText(s))
+	default:
+		panic("xml cst: SetText on " + n.Kind.String() + " node")
+	}
+}
+
+func (a *CSTAttr) valueStart() int {
+	i := strings.IndexByte(a.Raw, '=') + 1
+	for i < len(a.Raw) && isWhite(a.Raw[i]) {
+		i++
+	}
+	return i + 1
+}
+
+// Value returns the normalized attribute value
+func (a *CSTAttr) Value() string {
+	return normalizeAttrValue(RawString(a.Raw[a.valueStart() : len(a.Raw)-1]))
+}
+
+// SetValue replaces the value, keeping the spelling of the name, the spacing
+// around the equals sign and the quote character
+func (a *CSTAttr) SetValue(v string) {
+	start := a.valueStart()
+	quote := a.Raw[len(a.Raw)-1]
+	a.Raw = a.Raw[:start] + escapeCST(v, quote) + string(quote)
+}
+
+func (n *CSTNode) findAttr(name string) int {
+	for i, a := range n.Attrs {
+		if string(a.Name) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Attr returns the normalized value of the attribute
+func (n *CSTNode) Attr(name string) (string, bool) {
+	if i := n.findAttr(name); i >= 0 {
+		return n.Attrs[i].Value(), true
+	}
+	return "", false
+}
+
+// SetAttr changes the attribute value in place. New attributes are appended
+// with the same leading whitespace as the last existing attribute.
+func (n *CSTNode) SetAttr(name string, value string) {
+	if n.Kind != ElementNode {
+		panic("xml cst: SetAttr on " + n.Kind.String() + " node")
+	}
+	if i := n.findAttr(name); i >= 0 {
+		n.Attrs[i].SetValue(value)
+		return
+	}
+	lead := " "
+	quote := byte('"')
+	if len(n.Attrs) > 0 {
+		last := n.Attrs[len(n.Attrs)-1]
+		lead = last.Lead
+		quote = last.Raw[len(last.Raw)-1]
+	}
+	n.Attrs = append(n.Attrs, &CSTAttr{
+		Lead: lead,
+		Name: NameString(name),
+		Raw:  name + "=" + string(quote) + escapeCST(value, quote) + string(quote),
+	})
+}
+
+// RemoveAttr deletes the attribute together with its leading whitespace
+func (n *CSTNode) RemoveAttr(name string) bool {
+	i := n.findAttr(name)
+	if i < 0 {
+		return false
+	}
+	n.Attrs = append(n.Attrs[:i], n.Attrs[i+1:]...)
+	return true
+}
+
+// AppendChild adds c as the last child of n
+func (n *CSTNode) AppendChild(c *CSTNode) {
+	n.InsertBefore(c, nil)
+}
+
+// InsertBefore inserts c as a child of n, immediately before ref. When ref is
+// nil, c is appended. Empty-element tags are expanded as needed.
+func (n *CSTNode) InsertBefore(c, ref *CSTNode) {
+	if c.Parent != nil || c.PrevSibling != nil || c.NextSibling != nil {
+		panic("xml cst: inserted node already has a parent")
+	}
+	if ref != nil && ref.Parent != n {
+		panic("xml cst: reference node is not a child")
+	}
+	for p := n; p != nil; p = p.Parent {
+		if p == c {
+			panic("xml cst: inserted node is an ancestor")
+		}
+	}
+	if n.Kind == ElementNode && strings.HasSuffix(n.TagEnd, "/>") {
+		n.TagEnd = ">"
+		n.EndTag = "</" + string(n.Name) + ">"
+	}
+
+	var prev *CSTNode
+	if ref != nil {
+		prev = ref.PrevSibling
+	} else {
+		prev = n.LastChild
+	}
+	if prev != nil {
+		prev.NextSibling = c
+	} else {
+		n.FirstChild = c
+	}
+	if ref != nil {
+		ref.PrevSibling = c
+	} else {
+		n.LastChild = c
+	}
+	c.Parent = n
+	c.PrevSibling = prev
+	c.NextSibling = ref
+}
+
+// RemoveChild detaches c from n
+func (n *CSTNode) RemoveChild(c *CSTNode) {
+	if c.Parent != n {
+		panic("xml cst: removed node is not a child")
+	}
+	if n.FirstChild == c {
+		n.FirstChild = c.NextSibling
+	}
+	if c.NextSibling != nil {
+		c.NextSibling.PrevSibling = c.PrevSibling
+	}
+	if n.LastChild == c {
+		n.LastChild = c.PrevSibling
+	}
+	if c.PrevSibling != nil {
+		c.PrevSibling.NextSibling = c.NextSibling
+	}
+	c.Parent = nil
+	c.PrevSibling = nil
+	c.NextSibling = nil
+}
+
+// Indentation returns the whitespace that precedes the node on its line, or
+// an empty string if the node does not start a line
+func (n *CSTNode) Indentation() string {
+	indent, _ := n.lineIndent()
+	return indent
+}
+
+// lineIndent reports whether the node starts a line, and its indentation
+func (n *CSTNode) lineIndent() (string, bool) {
+	ws := n.Lead
+	if ws == "" && n.PrevSibling != nil && n.PrevSibling.Kind == TextNode {
+		ws = n.PrevSibling.Raw
+	}
+	i := strings.LastIndexByte(ws, '\n')
+	if i < 0 || strings.Trim(ws[i+1:], " \t") != "" {
+		return "", false
+	}
+	return ws[i+1:], true
+}
+
+// AppendElement adds c after the last child element of n. When that element
+// starts its own line, c is put on a new line with the same indentation.
+func (n *CSTNode) AppendElement(c *CSTNode) {
+	var last *CSTNode
+	for x := n.LastChild; x != nil; x = x.PrevSibling {
+		if x.Kind == ElementNode {
+			last = x
+			break
+		}
+	}
+	if last == nil {
+		n.AppendChild(c)
+		return
+	}
+	next := last.NextSibling
+	if indent, ok := last.lineIndent(); ok {
+		eol := lineBreak(last)
+		if n.Kind == DocumentNode {
+			c.Lead = eol + indent
+		} else {
+			n.InsertBefore(NewCSTText(eol+indent), next)
+		}
+	}
+	n.InsertBefore(c, next)
+}
+
+// lineBreak returns the line break style used before the node
+func lineBreak(n *CSTNode) string {
+	ws := n.Lead
+	if ws == "" && n.PrevSibling != nil {
+		ws = n.PrevSibling.Raw
+	}
+	if strings.Contains(ws, "\r\n") {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// RemoveElement detaches c from n together with the line it occupies, so no
+// blank line is left behind
+func (n *CSTNode) RemoveElement(c *CSTNode) {
+	if _, ok := c.lineIndent(); ok && c.Lead == "" {
+		p := c.PrevSibling
+		p.Raw = p.Raw[:strings.LastIndexByte(p.Raw, '\n')]
+		if strings.HasSuffix(p.Raw, "\r") {
+			p.Raw = p.Raw[:len(p.Raw)-1]
+		}
+		if p.Raw == "" {
+			n.RemoveChild(p)
+		}
+	}
+	n.RemoveChild(c)
+}
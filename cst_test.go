@@ -0,0 +1,103 @@
+package xg
+
+import (
+	"testing"
+)
+
+const cstExample = "\xef\xbb\xbf<?xml version='1.0'  encoding=\"UTF-8\" ?>\r\n" +
+	"<!DOCTYPE config>\r\n" +
+	"<config  version = '2'\r\n" +
+	"        mode=\"fast\" >\r\n" +
+	"  <!-- servers -->\r\n" +
+	"  <server name='a' port=\"80\"/>\r\n" +
+	"  <server name='b' port=\"81\"  >&#x41;&amp;B<![CDATA[<x>]]></server>\r\n" +
+	"  <?reload now?>\r\n" +
+	"</config >\r\n" +
+	"<!-- trailer -->\r\n\r\n"
+
+func TestCSTRoundTrip(t *testing.T) {
+	doc, err := ParseCST(cstExample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.String(); got != cstExample {
+		t.Errorf("got  %q\nwant %q", got, cstExample)
+	}
+
+	root := doc.Root()
+	if v, _ := root.Attr("version"); v != "2" {
+		t.Errorf("version = %q", v)
+	}
+	servers := root.Elements("server")
+	if len(servers) != 2 {
+		t.Fatalf("got %d servers", len(servers))
+	}
+	if s := servers[1].Text(); s != "A&B<x>" {
+		t.Errorf("text = %q", s)
+	}
+	if s := servers[0].Indentation(); s != "  " {
+		t.Errorf("indentation = %q", s)
+	}
+	if pi := root.LastChild.PrevSibling; pi.Kind != PINode || pi.Value() != "now" {
+		t.Errorf("unexpected pi: %q", pi.Raw)
+	}
+	if got := cstExample[servers[0].SrcPos : servers[0].SrcPos+7]; got != "<server" {
+		t.Errorf("source position: %q", got)
+	}
+}
+
+func TestCSTEdit(t *testing.T) {
+	doc, err := ParseCST(cstExample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := doc.Root()
+	servers := root.Elements("server")
+
+	root.SetAttr("version", "3")
+	root.SetAttr("note", `"quoted" & <tab>`+"\t")
+	servers[0].SetAttr("port", "8080")
+	servers[0].RemoveAttr("name")
+	servers[1].SetText("x < y")
+
+	c, err := ParseCSTElement(`<server name="c"/>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.AppendElement(c)
+
+	want := "\xef\xbb\xbf<?xml version='1.0'  encoding=\"UTF-8\" ?>\r\n" +
+		"<!DOCTYPE config>\r\n" +
+		"<config  version = '3'\r\n" +
+		"        mode=\"fast\"\r\n" +
+		"        note=\"&quot;quoted&quot; &amp; &lt;tab>&#9;\" >\r\n" +
+		"  <!-- servers -->\r\n" +
+		"  <server port=\"8080\"/>\r\n" +
+		"  <server name='b' port=\"81\"  >x &lt; y</server>\r\n" +
+		"  <server name=\"c\"/>\r\n" +
+		"  <?reload now?>\r\n" +
+		"</config >\r\n" +
+		"<!-- trailer -->\r\n\r\n"
+	if got := doc.String(); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	if v, _ := root.Attr("note"); v != `"quoted" & <tab>`+"\t" {
+		t.Errorf("note = %q", v)
+	}
+
+	root.RemoveElement(servers[0])
+	e := NewCSTElement("empty")
+	c.AppendChild(e)
+	e.AppendChild(NewCSTComment("a---b-"))
+	want = "\r\n<config  version = '3'\r\n" +
+		"        mode=\"fast\"\r\n" +
+		"        note=\"&quot;quoted&quot; &amp; &lt;tab>&#9;\" >\r\n" +
+		"  <!-- servers -->\r\n" +
+		"  <server name='b' port=\"81\"  >x &lt; y</server>\r\n" +
+		"  <server name=\"c\"><empty><!--a- - -b- --></empty></server>\r\n" +
+		"  <?reload now?>\r\n" +
+		"</config >"
+	if got := root.String(); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+package xg
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Occurrence specifies how many times a child element may appear within its
+// parent
+type Occurrence int
+
+const (
+	ZeroOrMore = Occurrence(iota) // optional, may be repeated
+	ZeroOrOne                     // optional, at most once
+	ExactlyOne                    // required, at most once
+	OneOrMore                     // required, may be repeated
+)
+
+func (o Occurrence) required() bool {
+	return o == ExactlyOne || o == OneOrMore
+}
+
+func (o Occurrence) repeatable() bool {
+	return o == ZeroOrMore || o == OneOrMore
+}
+
+// TagRule binds a child element handler with the element cardinality
+//
+// A rule with nil Handler declares a known element that is skipped.
+type TagRule struct {
+	Handler TagHandler
+	Occurs  Occurrence
+}
+
+// ErrUnexpectedTag is returned by RejectTag
+var ErrUnexpectedTag = errors.New("unexpected element")
+
+// RejectTag is a TagHandler that rejects any element. Use it as a Dispatch
+// fallback to fail on unknown child elements.
+func RejectTag(tag *Token, attrs AttributeList, content *Content) error {
+	return ErrUnexpectedTag
+}
+
+// Dispatch loops over the child elements and routes each of them to the
+// handler registered for its name. Elements without a handler are passed to
+// the fallback, or skipped when the fallback is nil.
+func (ci *Content) Dispatch(handlers map[NameString]TagHandler, fallback TagHandler) error {
+	rules := make(map[NameString]TagRule, len(handlers))
+	for n, h := range handlers {
+		rules[n] = TagRule{Handler: h}
+	}
+	return ci.DispatchRules(rules, fallback)
+}
+
+// DispatchRules works like Dispatch, it also validates the number of
+// occurrences of each child element against the rules
+func (ci *Content) DispatchRules(rules map[NameString]TagRule, fallback TagHandler) error {
+	counts := map[NameString]int{}
+
+	for ci.NextTag() {
+		tag := ci.t
+		rule, known := rules[tag.Name]
+		if !known {
+			if fallback == nil {
+				continue
+			}
+			rule.Handler = fallback
+		}
+
+		counts[tag.Name]++
+		if known && counts[tag.Name] > 1 && !rule.Occurs.repeatable() {
+			return ci.makeErrorAt(tag.SrcPos, "", fmt.Sprintf("duplicate element '%s'", tag.Name))
+		}
+
+		if rule.Handler == nil {
+			ci.HandleTag(nil)
+		} else {
+			ci.HandleTag(func(attrs AttributeList, content *Content) error {
+				return rule.Handler(tag, attrs, content)
+			})
+		}
+		if ci.err != nil {
+			if errors.Is(ci.err, ErrUnexpectedTag) {
+				ci.err = ci.makeErrorAt(tag.SrcPos, "", fmt.Sprintf("unexpected element '%s'", tag.Name))
+			}
+			return ci.err
+		}
+	}
+	if err := ci.Err(); err != nil {
+		return err
+	}
+
+	var missing []string
+	for n, rule := range rules {
+		if rule.Occurs.required() && counts[n] == 0 {
+			missing = append(missing, string(n))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return ci.MakeError("", fmt.Sprintf("missing required element '%s'", missing[0]))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package xg
+
+import (
+	"strings"
+	"testing"
+)
+
+type dispatchProject struct {
+	name    string
+	targets []string
+	notes   int
+}
+
+func parseDispatchProject(buf string, fallback TagHandler) (*dispatchProject, error) {
+	p := &dispatchProject{}
+	cc := Open(buf)
+	err := cc.DispatchRules(map[NameString]TagRule{
+		"project": {Occurs: ExactlyOne, Handler: func(tag *Token, attrs AttributeList, content *Content) error {
+			return content.DispatchRules(map[NameString]TagRule{
+				"name": {Occurs: ExactlyOne, Handler: func(tag *Token, attrs AttributeList, content *Content) error {
+					for content.Next() {
+						p.name += string(content.Value())
+					}
+					return content.Err()
+				}},
+				"target": {Occurs: OneOrMore, Handler: func(tag *Token, attrs AttributeList, content *Content) error {
+					id, _ := attrs.Attr("id")
+					p.targets = append(p.targets, id)
+					return nil
+				}},
+				"note": {Handler: func(tag *Token, attrs AttributeList, content *Content) error {
+					p.notes++
+					return nil
+				}},
+				"legacy": {},
+			}, fallback)
+		}},
+	}, nil)
+	return p, err
+}
+
+func TestDispatch(t *testing.T) {
+	p, err := parseDispatchProject(`<project>
+	<name>demo</name>
+	<target id="a"/>
+	<legacy><x/></legacy>
+	<note/><note/>
+	<target id="b"/>
+</project>`, RejectTag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.name != "demo" || strings.Join(p.targets, ",") != "a,b" || p.notes != 2 {
+		t.Errorf("unexpected result: %+v", p)
+	}
+}
+
+func TestDispatchErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		buf      string
+		fallback TagHandler
+		want     string
+	}{
+		{"missing", `<project><name/></project>`, nil,
+			"missing required element 'target'"},
+		{"duplicate", `<project><name/><name/><target/></project>`, nil,
+			"xml parser [1:17] /project: duplicate element 'name'"},
+		{"rejected", `<project><name/><target/>
+<other/></project>`, RejectTag,
+			"xml parser [2:1] /project: unexpected element 'other'"},
+		{"skipped", `<project><name/><target/><other/></project>`, nil,
+			""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseDispatchProject(tt.buf, tt.fallback)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if !strings.Contains(got, tt.want) || (tt.want == "") != (err == nil) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
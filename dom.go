@@ -0,0 +1,525 @@
+package xg
+
+import (
+	"errors"
+	"strings"
+)
+
+type NodeKind int
+
+const (
+	DocumentNode = NodeKind(iota)
+	ElementNode
+	TextNode
+	CDataNode
+	CommentNode
+	PINode
+	DeclNode      // <?xml ... ?> declaration
+	DocTypeNode   // <!DOCTYPE ... >
+	AttributeNode // only produced by XPath selections
+	NamespaceNode // only produced by XPath selections
+)
+
+func (k NodeKind) String() string {
+	switch k {
+	case DocumentNode:
+		return "Document"
+	case ElementNode:
+		return "Element"
+	case TextNode:
+		return "Text"
+	case CDataNode:
+		return "CData"
+	case CommentNode:
+		return "Comment"
+	case PINode:
+		return "PI"
+	case DeclNode:
+		return "Decl"
+	case DocTypeNode:
+		return "DocType"
+	case AttributeNode:
+		return "Attribute"
+	case NamespaceNode:
+		return "Namespace"
+	default:
+		return "UNKNOWN_NODE"
+	}
+}
+
+// Node is a node of an in-memory document tree
+//
+// Nodes created by ParseDocument and BuildElement keep byte offsets of their
+// source within the original buffer. Nodes created programmatically have
+// SrcPos set to -1.
+type Node struct {
+	Kind  NodeKind
+	Name  NameString // element name, PI target, or DOCTYPE root name
+	Value string     // text, CDATA, comment, PI data, DOCTYPE content, or declared encoding
+	Attrs []Attr     // element attributes, or the pseudo-attributes of a declaration
+
+	Parent      *Node
+	FirstChild  *Node
+	LastChild   *Node
+	PrevSibling *Node
+	NextSibling *Node
+
+	SrcPos int // offset of the first byte within the source buffer
+	SrcEnd int // offset past the last byte within the source buffer
+}
+
+// Attr is an element attribute, the Value is unescaped and normalized
+type Attr struct {
+	Name   NameString
+	Value  string
+	SrcPos int
+}
+
+func NewDocument() *Node {
+	return &Node{Kind: DocumentNode, SrcPos: -1, SrcEnd: -1}
+}
+
+func NewElement(name NameString) *Node {
+	return &Node{Kind: ElementNode, Name: name, SrcPos: -1, SrcEnd: -1}
+}
+
+func NewText(s string) *Node {
+	return &Node{Kind: TextNode, Value: s, SrcPos: -1, SrcEnd: -1}
+}
+
+func NewCData(s string) *Node {
+	return &Node{Kind: CDataNode, Value: s, SrcPos: -1, SrcEnd: -1}
+}
+
+func NewComment(s string) *Node {
+	return &Node{Kind: CommentNode, Value: s, SrcPos: -1, SrcEnd: -1}
+}
+
+func NewPI(target NameString, data string) *Node {
+	return &Node{Kind: PINode, Name: target, Value: data, SrcPos: -1, SrcEnd: -1}
+}
+
+// ParseDocument builds a document tree from the buffer
+func ParseDocument(buf string) (*Node, error) {
+	return BuildDocument(Open(buf))
+}
+
+// BuildDocument builds a document tree from the remaining content
+func BuildDocument(ci *Content) (*Node, error) {
+	doc := NewDocument()
+	if ci != nil && ci.tt != nil {
+		doc.SrcPos, doc.SrcEnd = ci.tt.cur, len(ci.tt.buf)
+	}
+	err := ci.buildNodes(doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+var errNotAtElement = errors.New("xml dom: content is not positioned at an element")
+
+// BuildElement builds a subtree for the element at the current position
+func (ci *Content) BuildElement() (*Node, error) {
+	if !ci.IsTag() {
+		return nil, errNotAtElement
+	}
+	n := NewElement(ci.t.Name)
+	n.SrcPos = ci.t.SrcPos
+	ci.HandleTag(func(attrs AttributeList, content *Content) error {
+		for _, a := range attrs {
+			n.Attrs = append(n.Attrs, Attr{Name: a.Name, Value: normalizeAttrValue(a.Value), SrcPos: a.SrcPos})
+		}
+		attrs.MarkHandled()
+		return content.buildNodes(n)
+	})
+	if ci.err != nil {
+		return nil, ci.err
+	}
+	n.SrcEnd = ci.tt.cur
+	return n, nil
+}
+
+func (ci *Content) buildNodes(parent *Node) error {
+	for ci.Next() {
+		t := ci.t
+		if t.Kind == Tag {
+			n, err := ci.BuildElement()
+			if err != nil {
+				return err
+			}
+			parent.AppendChild(n)
+			continue
+		}
+
+		n := &Node{Name: t.Name, Value: string(t.Value), SrcPos: t.SrcPos, SrcEnd: t.SrcPos + len(t.Raw)}
+		switch t.Kind {
+		case SData:
+			n.Kind = TextNode
+			n.Value = t.Value.Unscrambled()
+		case CData:
+			n.Kind = CDataNode
+			n.Value = normalizeLineEnds(n.Value)
+		case Comment:
+			n.Kind = CommentNode
+			n.Value = normalizeLineEnds(n.Value)
+		case PI:
+			n.Kind = PINode
+			n.Value = normalizeLineEnds(n.Value)
+		case XmlDecl:
+			n.Kind = DeclNode
+			n.Attrs = declAttrs(t.Raw, t.SrcPos)
+		case DocTypeDecl:
+			n.Kind = DocTypeNode
+		default:
+			continue
+		}
+		parent.AppendChild(n)
+	}
+	return ci.Err()
+}
+
+// declAttrs returns the version, encoding and standalone pseudo-attributes
+// of an XML declaration that starts at offset pos of the source
+func declAttrs(raw string, pos int) []Attr {
+	i := strings.Index(raw, "<?xml") + 5
+	tt := &tokenizer{buf: strings.TrimSuffix(raw[i:], "?>")}
+	var aa []Attr
+	for tt.skipWhite(); tt.cur < len(tt.buf); tt.skipWhite() {
+		o := tt.cur
+		name, value, ec := tt.readAttrPair()
+		if ec != ErrCodeOk {
+			break
+		}
+		aa = append(aa, Attr{Name: name, Value: string(value), SrcPos: pos + i + o})
+	}
+	return aa
+}
+
+// normalizeLineEnds replaces \r\n and lone \r with \n, as XML processors do
+// before parsing
+func normalizeLineEnds(s string) string {
+	if !strings.Contains(s, "\r") {
+		return s
+	}
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+}
+
+// normalizeAttrValue unescapes the attribute value and replaces literal
+// whitespace characters with spaces, as required by the XML specification
+func normalizeAttrValue(rs RawString) string {
+	s := string(rs)
+	if strings.ContainsAny(s, "\t\r\n") {
+		s = strings.ReplaceAll(s, "\r\n", " ")
+		s = strings.Map(func(r rune) rune {
+			if r == '\t' || r == '\r' || r == '\n' {
+				return ' '
+			}
+			return r
+		}, s)
+	}
+	return unscramble(s)
+}
+
+const (
+	xmlNamespaceURI   = "http://www.w3.org/XML/1998/namespace"
+	xmlnsNamespaceURI = "http://www.w3.org/2000/xmlns/"
+)
+
+func splitQName(name NameString) (prefix, local string) {
+	if i := strings.IndexByte(string(name), ':'); i >= 0 {
+		return string(name[:i]), string(name[i+1:])
+	}
+	return "", string(name)
+}
+
+// Prefix returns the namespace prefix of an element or attribute name
+func (n *Node) Prefix() string {
+	prefix, _ := splitQName(n.Name)
+	return prefix
+}
+
+// LocalName returns the name without the namespace prefix
+func (n *Node) LocalName() string {
+	_, local := splitQName(n.Name)
+	return local
+}
+
+// NamespaceURI resolves the namespace of an element or attribute name using
+// xmlns declarations in scope. Unprefixed attributes have no namespace.
+func (n *Node) NamespaceURI() string {
+	prefix := n.Prefix()
+	switch n.Kind {
+	case ElementNode:
+		uri, _ := n.LookupNamespace(prefix)
+		return uri
+	case AttributeNode:
+		if prefix == "" || n.Parent == nil {
+			return ""
+		}
+		uri, _ := n.Parent.LookupNamespace(prefix)
+		return uri
+	}
+	return ""
+}
+
+// LookupNamespace returns the namespace URI bound to the prefix in the scope
+// of the node. An empty prefix looks up the default namespace.
+func (n *Node) LookupNamespace(prefix string) (string, bool) {
+	switch prefix {
+	case "xml":
+		return xmlNamespaceURI, true
+	case "xmlns":
+		return xmlnsNamespaceURI, true
+	}
+	name := "xmlns"
+	if prefix != "" {
+		name += ":" + prefix
+	}
+	for e := n; e != nil; e = e.Parent {
+		if e.Kind != ElementNode {
+			continue
+		}
+		if uri, ok := e.Attr(name); ok {
+			return uri, uri != "" || prefix == ""
+		}
+	}
+	return "", prefix == ""
+}
+
+// Children returns a slice of the child nodes
+func (n *Node) Children() []*Node {
+	var ret []*Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		ret = append(ret, c)
+	}
+	return ret
+}
+
+// Elements returns child elements, optionally filtered by name
+func (n *Node) Elements(name ...NameString) []*Node {
+	var ret []*Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Kind != ElementNode {
+			continue
+		}
+		if len(name) == 0 {
+			ret = append(ret, c)
+			continue
+		}
+		for _, nm := range name {
+			if c.Name == nm {
+				ret = append(ret, c)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// Root returns the document element
+func (n *Node) Root() *Node {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	if n.Kind == ElementNode {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Kind == ElementNode {
+			return c
+		}
+	}
+	return nil
+}
+
+// Text returns concatenated text and CDATA content of the node and its
+// descendants
+func (n *Node) Text() string {
+	switch n.Kind {
+	case TextNode, CDataNode:
+		return n.Value
+	case DocumentNode, ElementNode:
+		var b strings.Builder
+		var walk func(n *Node)
+		walk = func(n *Node) {
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				switch c.Kind {
+				case TextNode, CDataNode:
+					b.WriteString(c.Value)
+				case ElementNode:
+					walk(c)
+				}
+			}
+		}
+		walk(n)
+		return b.String()
+	}
+	return ""
+}
+
+func (n *Node) Attr(name string) (string, bool) {
+	for _, a := range n.Attrs {
+		if string(a.Name) == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// SetAttr replaces the value of an existing attribute, or appends a new one
+func (n *Node) SetAttr(name string, value string) {
+	for i := range n.Attrs {
+		if string(n.Attrs[i].Name) == name {
+			n.Attrs[i].Value = value
+			return
+		}
+	}
+	n.Attrs = append(n.Attrs, Attr{Name: NameString(name), Value: value, SrcPos: -1})
+}
+
+// RemoveAttr removes the attribute, returns false if it does not exist
+func (n *Node) RemoveAttr(name string) bool {
+	for i := range n.Attrs {
+		if string(n.Attrs[i].Name) == name {
+			n.Attrs = append(n.Attrs[:i], n.Attrs[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// AppendChild adds c as the last child of n
+func (n *Node) AppendChild(c *Node) {
+	n.InsertBefore(c, nil)
+}
+
+// InsertBefore inserts c as a child of n, immediately before ref. When ref is
+// nil, c is appended.
+func (n *Node) InsertBefore(c, ref *Node) {
+	if c.Parent != nil || c.PrevSibling != nil || c.NextSibling != nil {
+		panic("xml dom: inserted node already has a parent")
+	}
+	if ref != nil && ref.Parent != n {
+		panic("xml dom: reference node is not a child")
+	}
+	for p := n; p != nil; p = p.Parent {
+		if p == c {
+			panic("xml dom: inserted node is an ancestor")
+		}
+	}
+
+	var prev *Node
+	if ref != nil {
+		prev = ref.PrevSibling
+	} else {
+		prev = n.LastChild
+	}
+	if prev != nil {
+		prev.NextSibling = c
+	} else {
+		n.FirstChild = c
+	}
+	if ref != nil {
+		ref.PrevSibling = c
+	} else {
+		n.LastChild = c
+	}
+	c.Parent = n
+	c.PrevSibling = prev
+	c.NextSibling = ref
+}
+
+// RemoveChild detaches c from n
+func (n *Node) RemoveChild(c *Node) {
+	if c.Parent != n {
+		panic("xml dom: removed node is not a child")
+	}
+	if n.FirstChild == c {
+		n.FirstChild = c.NextSibling
+	}
+	if c.NextSibling != nil {
+		c.NextSibling.PrevSibling = c.PrevSibling
+	}
+	if n.LastChild == c {
+		n.LastChild = c.PrevSibling
+	}
+	if c.PrevSibling != nil {
+		c.PrevSibling.NextSibling = c.NextSibling
+	}
+	c.Parent = nil
+	c.PrevSibling = nil
+	c.NextSibling = nil
+}
+
+// ReplaceChild puts c in place of the old child
+func (n *Node) ReplaceChild(c, old *Node) {
+	if old.Parent != n {
+		panic("xml dom: replaced node is not a child")
+	}
+	if c == old {
+		return
+	}
+	next := old.NextSibling
+	n.RemoveChild(old)
+	n.InsertBefore(c, next)
+}
+
+// MarshalXG writes the node and its descendants
+func (n *Node) MarshalXG(w *Writer) error {
+	switch n.Kind {
+	case DocumentNode:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.PrevSibling != nil && c.PrevSibling.Kind != DeclNode {
+				w.newline()
+			}
+			if err := c.MarshalXG(w); err != nil {
+				return err
+			}
+		}
+	case ElementNode:
+		w.OTag(string(n.Name))
+		for _, a := range n.Attrs {
+			w.StringAttr(string(a.Name), a.Value)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if err := c.MarshalXG(w); err != nil {
+				return err
+			}
+		}
+		w.CTag()
+	case TextNode:
+		w.String(n.Value)
+	case CDataNode:
+		w.CData(n.Value)
+	case CommentNode:
+		w.Comment(n.Value)
+	case PINode:
+		w.PI(string(n.Name), n.Value)
+	case DeclNode:
+		if len(n.Attrs) == 0 {
+			w.XmlDecl()
+			break
+		}
+		w.put("<?xml")
+		for _, a := range n.Attrs {
+			w.put(" ")
+			w.put(string(a.Name))
+			w.put(`="`)
+			w.put(a.Value)
+			w.put(`"`)
+		}
+		w.put("?>")
+		w.newline()
+	case DocTypeNode:
+		w.beginMarkup()
+		w.put("<!DOCTYPE ")
+		w.put(string(n.Name))
+		if n.Value != "" {
+			w.put(" ")
+			w.put(n.Value)
+		}
+		w.put(">")
+	}
+	return nil
+}
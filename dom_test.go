@@ -0,0 +1,144 @@
+package xg
+
+import (
+	"bytes"
+	"testing"
+)
+
+const domExample = `<?xml version="1.0" encoding="UTF-8"?>
+<!-- catalog -->
+<catalog kind="books">
+	<book id="b1" note="a&#10;b
+c">Go &amp; XML</book>
+	<book id="b2"><![CDATA[<raw>]]></book>
+	<?render fast?>
+</catalog>`
+
+func marshalNode(t *testing.T, n *Node) string {
+	t.Helper()
+	out := &bytes.Buffer{}
+	w := NewWriter(out)
+	if err := n.MarshalXG(w); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestDOMParse(t *testing.T) {
+	doc, err := ParseDocument(domExample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := doc.Root()
+	if root == nil || root.Name != "catalog" {
+		t.Fatalf("unexpected root: %v", root)
+	}
+	if k := doc.FirstChild.Kind; k != DeclNode {
+		t.Errorf("first node kind = %v", k)
+	}
+	if k := doc.FirstChild.NextSibling.Kind; k != CommentNode {
+		t.Errorf("second node kind = %v", k)
+	}
+
+	books := root.Elements("book")
+	if len(books) != 2 {
+		t.Fatalf("got %d books", len(books))
+	}
+	if v, _ := books[0].Attr("note"); v != "a\nb c" {
+		t.Errorf("normalized attribute = %q", v)
+	}
+	if s := books[0].Text(); s != "Go & XML" {
+		t.Errorf("text = %q", s)
+	}
+	if s := books[1].Text(); s != "<raw>" {
+		t.Errorf("cdata = %q", s)
+	}
+	if got := domExample[books[1].SrcPos:books[1].SrcEnd]; got != `<book id="b2"><![CDATA[<raw>]]></book>` {
+		t.Errorf("source = %q", got)
+	}
+	if books[0].NextSibling.Kind != TextNode || books[1].Parent != root {
+		t.Errorf("unexpected tree structure")
+	}
+	if pi := root.LastChild.PrevSibling; pi.Kind != PINode || pi.Name != "render" || pi.Value != "fast" {
+		t.Errorf("unexpected pi: %+v", pi)
+	}
+}
+
+func TestDOMMutate(t *testing.T) {
+	doc, err := ParseDocument(`<a><b/><c x="1"/></a>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := doc.Root()
+	b, c := a.FirstChild, a.LastChild
+
+	c.SetAttr("x", "2")
+	c.SetAttr("y", `"q"`)
+	b.SetAttr("gone", "1")
+	b.RemoveAttr("gone")
+
+	d := NewElement("d")
+	d.AppendChild(NewText("1 < 2"))
+	a.InsertBefore(d, c)
+	a.InsertBefore(NewComment("note"), b)
+
+	e := NewElement("e")
+	e.AppendChild(NewCData("x]]>y"))
+	a.ReplaceChild(e, b)
+	a.AppendChild(NewPI("pi", "data"))
+
+	want := `<a><!--note--><e><![CDATA[x]]]]><![CDATA[>y]]></e><d>1 &lt; 2</d><c x="2" y="&quot;q&quot;" /><?pi data?></a>`
+	if got := marshalNode(t, doc); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	a.RemoveChild(d)
+	if d.Parent != nil || e.NextSibling != c || c.PrevSibling != e {
+		t.Errorf("links are not updated after removal")
+	}
+}
+
+func TestDOMRoundTrip(t *testing.T) {
+	doc, err := ParseDocument(domExample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<!-- catalog -->
+<catalog kind="books">
+	<book id="b1" note="a&#10;b c">Go &amp; XML</book>
+	<book id="b2"><![CDATA[<raw>]]></book>
+	<?render fast?>
+</catalog>`
+	if got := marshalNode(t, doc); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestDOMDeclaration(t *testing.T) {
+	for _, in := range []string{
+		`<?xml version="1.0" encoding="ISO-8859-1" standalone="yes"?>` + "\n<a />",
+		`<?xml version="1.1"?>` + "\n<a />",
+	} {
+		doc, err := ParseDocument(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := marshalNode(t, doc); got != in {
+			t.Errorf("got  %s\nwant %s", got, in)
+		}
+	}
+
+	doc, err := ParseDocument(`<?xml version='1.0' standalone='no' ?><a/>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := doc.FirstChild.Attr("standalone"); v != "no" {
+		t.Errorf("standalone = %q", v)
+	}
+	for _, in := range []string{`<?xml encoding="UTF-8" version="1.0"?><a/>`, `<?xml version="1.0" x="1"?><a/>`} {
+		if _, err := ParseDocument(in); err == nil {
+			t.Errorf("%s: no error", in)
+		}
+	}
+}
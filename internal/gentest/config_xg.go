@@ -0,0 +1,409 @@
+// Code generated by xg-gen -type Config,Server,Point; DO NOT EDIT.
+
+package gentest
+
+import (
+	"strconv"
+	"strings"
+
+	xg "github.com/adnsv/xmlgo"
+)
+
+// DecodeXG decodes the current tag of ci into v
+func (v *Config) DecodeXG(ci *xg.Content) error {
+	path := ci.TagPath()
+	ci.HandleTag(func(attrs xg.AttributeList, content *xg.Content) error {
+		attrs.MarkNamespaces()
+		if s, ok := attrs.Attr("version"); ok {
+			n, err := xg.ParseFloat(s, 64)
+			if err != nil {
+				return ci.DecodeAttr(attrs, "version", path, &v.Version)
+			}
+			v.Version = n
+		}
+		if content == nil {
+			return nil
+		}
+		var chardata strings.Builder
+		textPos := -1
+		var comments strings.Builder
+		for content.Next() {
+			switch content.Kind() {
+			case xg.Tag:
+				switch content.Name() {
+				case "name":
+					content.HandleTag(func(attrs xg.AttributeList, content *xg.Content) error {
+						attrs.MarkNamespaces()
+						s, _, err := content.CharData()
+						if err != nil {
+							return err
+						}
+						v.Name = s
+						return nil
+					})
+				case "server":
+					var e Server
+					if err := e.DecodeXG(content); err != nil {
+						return err
+					}
+					v.Servers = append(v.Servers, e)
+				case "backup":
+					e := new(Server)
+					if err := e.DecodeXG(content); err != nil {
+						return err
+					}
+					v.Backups = append(v.Backups, e)
+				case "primary":
+					if v.Primary == nil {
+						v.Primary = new(Server)
+					}
+					if err := v.Primary.DecodeXG(content); err != nil {
+						return err
+					}
+				case "port":
+					content.HandleTag(func(attrs xg.AttributeList, content *xg.Content) error {
+						attrs.MarkNamespaces()
+						s, pos, err := content.CharData()
+						if err != nil {
+							return err
+						}
+						var e uint16
+						n, err := xg.ParseUint(s, 16)
+						if err != nil {
+							return content.DecodeText(pos, s, &e)
+						}
+						e = uint16(n)
+						v.Ports = append(v.Ports, e)
+						return nil
+					})
+				case "enabled":
+					content.HandleTag(func(attrs xg.AttributeList, content *xg.Content) error {
+						attrs.MarkNamespaces()
+						s, pos, err := content.CharData()
+						if err != nil {
+							return err
+						}
+						if v.Enabled == nil {
+							v.Enabled = new(bool)
+						}
+						n, err := xg.ParseBool(s)
+						if err != nil {
+							return content.DecodeText(pos, s, &v.Enabled)
+						}
+						*v.Enabled = n
+						return nil
+					})
+				case "data":
+					content.HandleTag(func(attrs xg.AttributeList, content *xg.Content) error {
+						attrs.MarkNamespaces()
+						s, _, err := content.CharData()
+						if err != nil {
+							return err
+						}
+						v.Data = []byte(s)
+						return nil
+					})
+				case "origin":
+					if err := v.Origin.DecodeXG(content); err != nil {
+						return err
+					}
+				case "level":
+					if err := content.DecodeChild(&v.Levels); err != nil {
+						return err
+					}
+				case "extra":
+					if err := content.DecodeChild(&v.Extra); err != nil {
+						return err
+					}
+				case "info":
+					content.HandleTag(func(_ xg.AttributeList, content *xg.Content) error {
+						for content.NextTag() {
+							switch content.Name() {
+							case "title":
+								content.HandleTag(func(attrs xg.AttributeList, content *xg.Content) error {
+									attrs.MarkNamespaces()
+									s, _, err := content.CharData()
+									if err != nil {
+										return err
+									}
+									v.Title = s
+									return nil
+								})
+							case "author":
+								content.HandleTag(func(attrs xg.AttributeList, content *xg.Content) error {
+									attrs.MarkNamespaces()
+									s, _, err := content.CharData()
+									if err != nil {
+										return err
+									}
+									var e string
+									e = s
+									v.Authors = append(v.Authors, e)
+									return nil
+								})
+							}
+						}
+						return content.Err()
+					})
+				}
+			case xg.SData, xg.CData:
+				if textPos < 0 {
+					textPos = content.Token().SrcPos
+				}
+				if content.IsCData() {
+					chardata.WriteString(string(content.Value()))
+				} else {
+					chardata.WriteString(content.Value().Unscrambled())
+				}
+			case xg.Comment:
+				comments.WriteString(string(content.Value()))
+			}
+		}
+		if err := content.Err(); err != nil {
+			return err
+		}
+		{
+			s := chardata.String()
+			n, err := xg.ParseUint(s, 64)
+			if err != nil {
+				return content.DecodeText(textPos, s, &v.Size)
+			}
+			v.Size = n
+		}
+		{
+			s := comments.String()
+			v.Comment = s
+		}
+		return nil
+	})
+	return ci.Err()
+}
+
+// EncodeXG writes v as an element with the given name
+func (v *Config) EncodeXG(w *xg.Writer, name string) error {
+	w.OTag(name)
+	w.StringAttr("version", strconv.FormatFloat(v.Version, 'g', -1, 64))
+	var parents []string
+	setParents := func(names ...string) {
+		n := 0
+		for n < len(parents) && n < len(names) && parents[n] == names[n] {
+			n++
+		}
+		for len(parents) > n {
+			w.CTag()
+			parents = parents[:len(parents)-1]
+		}
+		for _, name := range names[n:] {
+			w.OTag(name)
+			parents = append(parents, name)
+		}
+	}
+	setParents()
+	w.OTag("name")
+	w.String(v.Name)
+	w.CTag()
+	setParents("info")
+	w.OTag("title")
+	w.String(v.Title)
+	w.CTag()
+	setParents("info")
+	for i := range v.Authors {
+		w.OTag("author")
+		w.String(v.Authors[i])
+		w.CTag()
+	}
+	setParents()
+	for i := range v.Servers {
+		if err := v.Servers[i].EncodeXG(w, "server"); err != nil {
+			return err
+		}
+	}
+	setParents()
+	for i := range v.Backups {
+		if v.Backups[i] != nil {
+			if err := v.Backups[i].EncodeXG(w, "backup"); err != nil {
+				return err
+			}
+		}
+	}
+	if v.Primary != nil {
+		setParents()
+		if err := v.Primary.EncodeXG(w, "primary"); err != nil {
+			return err
+		}
+	}
+	setParents()
+	for i := range v.Ports {
+		w.OTag("port")
+		w.String(strconv.FormatUint(uint64(v.Ports[i]), 10))
+		w.CTag()
+	}
+	if v.Enabled != nil {
+		setParents()
+		w.OTag("enabled")
+		w.String(strconv.FormatBool(*v.Enabled))
+		w.CTag()
+	}
+	if len(v.Data) != 0 {
+		setParents()
+		w.OTag("data")
+		w.String(string(v.Data))
+		w.CTag()
+	}
+	setParents()
+	if err := v.Origin.EncodeXG(w, "origin"); err != nil {
+		return err
+	}
+	setParents()
+	if err := w.WriteElement("level", &v.Levels); err != nil {
+		return err
+	}
+	setParents()
+	if err := w.WriteElement("extra", &v.Extra); err != nil {
+		return err
+	}
+	setParents()
+	if s := strconv.FormatUint(v.Size, 10); s != "" {
+		w.String(s)
+	}
+	if s := v.Comment; s != "" {
+		w.Comment(s)
+	}
+	w.CTag()
+	return nil
+}
+
+// DecodeXG decodes the current tag of ci into v
+func (v *Server) DecodeXG(ci *xg.Content) error {
+	path := ci.TagPath()
+	ci.HandleTag(func(attrs xg.AttributeList, content *xg.Content) error {
+		attrs.MarkNamespaces()
+		if s, ok := attrs.Attr("id"); ok {
+			v.Base.ID = s
+		}
+		if s, ok := attrs.Attr("port"); ok {
+			n, err := xg.ParseInt(s, strconv.IntSize)
+			if err != nil {
+				return ci.DecodeAttr(attrs, "port", path, &v.Port)
+			}
+			v.Port = int(n)
+		}
+		if s, ok := attrs.Attr("secure"); ok {
+			if v.Secure == nil {
+				v.Secure = new(bool)
+			}
+			n, err := xg.ParseBool(s)
+			if err != nil {
+				return ci.DecodeAttr(attrs, "secure", path, &v.Secure)
+			}
+			*v.Secure = n
+		}
+		if err := ci.DecodeAttr(attrs, "level", path, &v.Level); err != nil {
+			return err
+		}
+		if s, ok := attrs.Attr("weight"); ok {
+			n, err := xg.ParseFloat(s, 32)
+			if err != nil {
+				return ci.DecodeAttr(attrs, "weight", path, &v.Weight)
+			}
+			v.Weight = float32(n)
+		}
+		if content == nil {
+			return nil
+		}
+		var chardata strings.Builder
+		for content.Next() {
+			switch content.Kind() {
+			case xg.Tag:
+				switch content.Name() {
+				case "note":
+					content.HandleTag(func(attrs xg.AttributeList, content *xg.Content) error {
+						attrs.MarkNamespaces()
+						s, _, err := content.CharData()
+						if err != nil {
+							return err
+						}
+						v.Base.Note = s
+						return nil
+					})
+				}
+			case xg.SData, xg.CData:
+				if content.IsCData() {
+					chardata.WriteString(string(content.Value()))
+				} else {
+					chardata.WriteString(content.Value().Unscrambled())
+				}
+			}
+		}
+		if err := content.Err(); err != nil {
+			return err
+		}
+		{
+			s := chardata.String()
+			v.Address = s
+		}
+		return nil
+	})
+	return ci.Err()
+}
+
+// EncodeXG writes v as an element with the given name
+func (v *Server) EncodeXG(w *xg.Writer, name string) error {
+	w.OTag(name)
+	w.StringAttr("id", v.Base.ID)
+	w.StringAttr("port", strconv.FormatInt(int64(v.Port), 10))
+	if v.Secure != nil {
+		w.StringAttr("secure", strconv.FormatBool(*v.Secure))
+	}
+	if v.Level != 0 {
+		w.Attr("level", &v.Level)
+	}
+	if v.Weight != 0 {
+		w.StringAttr("weight", strconv.FormatFloat(float64(v.Weight), 'g', -1, 32))
+	}
+	if len(v.Base.Note) != 0 {
+		w.OTag("note")
+		w.String(v.Base.Note)
+		w.CTag()
+	}
+	if s := v.Address; s != "" {
+		w.CData(s)
+	}
+	w.CTag()
+	return nil
+}
+
+// DecodeXG decodes the current tag of ci into v
+func (v *Point) DecodeXG(ci *xg.Content) error {
+	path := ci.TagPath()
+	ci.HandleTag(func(attrs xg.AttributeList, content *xg.Content) error {
+		attrs.MarkNamespaces()
+		if s, ok := attrs.Attr("x"); ok {
+			n, err := xg.ParseInt(s, 8)
+			if err != nil {
+				return ci.DecodeAttr(attrs, "x", path, &v.X)
+			}
+			v.X = int8(n)
+		}
+		if s, ok := attrs.Attr("y"); ok {
+			n, err := xg.ParseInt(s, 8)
+			if err != nil {
+				return ci.DecodeAttr(attrs, "y", path, &v.Y)
+			}
+			v.Y = int8(n)
+		}
+		return nil
+	})
+	return ci.Err()
+}
+
+// EncodeXG writes v as an element with the given name
+func (v *Point) EncodeXG(w *xg.Writer, name string) error {
+	w.OTag(name)
+	w.StringAttr("x", strconv.FormatInt(int64(v.X), 10))
+	if v.Y != 0 {
+		w.StringAttr("y", strconv.FormatInt(int64(v.Y), 10))
+	}
+	w.CTag()
+	return nil
+}
@@ -0,0 +1,121 @@
+package gentest
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	xg "github.com/adnsv/xmlgo"
+)
+
+const sample = `<?xml version="1.0" encoding="UTF-8"?>
+<config version="1.5" xmlns:x="urn:x">
+	<!-- main -->
+	<name>main &amp; only</name>
+	<info><title>T</title><author>a</author><author>b</author></info>
+	<server id="a" port="80" level="low" weight="0.5">10.0.0.1<note>first</note></server>
+	<server id="b" port="81" secure="true"><![CDATA[10.0.0.2]]></server>
+	<backup id="c" port="82"/>
+	<primary id="d" port="83"/>
+	<port>1</port><port> 2 </port>
+	<enabled>true</enabled>
+	<data>bytes</data>
+	<origin x="-3" y="4"/>
+	<level>high</level><level/>
+	<extra max="10"/>
+	42
+</config>`
+
+func decodeGenerated(buf string) (Config, string) {
+	var c Config
+	ci := xg.Open(buf)
+	ci.SetStrict(xg.StrictWarn)
+	var err error
+	if ci.NextTag() {
+		err = c.DecodeXG(ci)
+	} else {
+		err = ci.Err()
+	}
+	return c, result(ci, err)
+}
+
+func decodeReflect(buf string) (Config, string) {
+	var c Config
+	ci := xg.Open(buf)
+	ci.SetStrict(xg.StrictWarn)
+	err := ci.Decode(&c)
+	return c, result(ci, err)
+}
+
+// result joins the error and the strict mode warnings
+func result(ci *xg.Content, err error) string {
+	var msgs []string
+	if err != nil {
+		msgs = append(msgs, err.Error())
+	}
+	for _, w := range ci.Warnings() {
+		msgs = append(msgs, w.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  string
+	}{
+		{"sample", sample},
+		{"empty", `<config/>`},
+		{"unknown", `<config extra="1"><unknown/><info a="1"><x/></info><server q="1"/></config>`},
+		{"attr", "<config>\n<server port='x'/></config>"},
+		{"fallback attr", `<config><server level="mid"/></config>`},
+		{"ptr attr", `<config><primary secure="maybe"/></config>`},
+		{"element", `<config><port>70000</port></config>`},
+		{"ptr element", `<config><enabled>maybe</enabled></config>`},
+		{"fallback element", `<config><level>mid</level></config>`},
+		{"chardata", `<config>4<name/>x</config>`},
+		{"nested", `<config><origin x="300"/></config>`},
+		{"syntax", `<config><name>a</nam></config>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, wantErr := decodeReflect(tt.buf)
+			got, gotErr := decodeGenerated(tt.buf)
+			if gotErr != wantErr {
+				t.Errorf("errors differ\ngot  %s\nwant %s", gotErr, wantErr)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("values differ\ngot  %+v\nwant %+v", got, want)
+			}
+		})
+	}
+
+	got, _ := decodeGenerated(sample)
+	if got.Size != 42 || len(got.Servers) != 2 || got.Servers[0].Level != 1 || got.Comment != " main " {
+		t.Errorf("unexpected value %+v", got)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	full, _ := decodeReflect(sample)
+	yes := false
+	full.Enabled = &yes
+	full.Backups = append(full.Backups, nil)
+	for _, c := range []Config{full, {}, {Title: "t", Name: "n", Authors: []string{"a"}}} {
+		want := &bytes.Buffer{}
+		w := xg.NewWriter(want)
+		w.OTag("config")
+		w.Write(&c)
+		w.CTag()
+
+		got := &bytes.Buffer{}
+		w = xg.NewWriter(got)
+		if err := c.EncodeXG(w, "config"); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("outputs differ\ngot  %s\nwant %s", got, want)
+		}
+	}
+}
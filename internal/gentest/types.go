@@ -0,0 +1,67 @@
+// Package gentest checks that the code generated by cmd/xg-gen behaves like
+// the reflection path
+package gentest
+
+import "fmt"
+
+//go:generate go run ../../cmd/xg-gen -type Config,Server,Point
+
+// Level is passed to the reflection path, it implements text marshaling
+type Level int
+
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte([]string{"", "low", "high"}[l]), nil
+}
+
+func (l *Level) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "":
+		*l = 0
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return fmt.Errorf("invalid level %q", b)
+	}
+	return nil
+}
+
+type Base struct {
+	ID   string `xg:"id,attr"`
+	Note string `xg:"note,omitempty"`
+}
+
+type Server struct {
+	Base
+	Port    int     `xg:"port,attr"`
+	Secure  *bool   `xg:"secure,attr"`
+	Level   Level   `xg:"level,attr,omitempty"`
+	Weight  float32 `xg:"weight,attr,omitempty"`
+	Address string  `xg:",cdata"`
+}
+
+type Point struct {
+	X int8 `xml:"x,attr"`
+	Y int8 `xml:"y,attr,omitempty"`
+}
+
+type Config struct {
+	Version float64   `xg:"version,attr"`
+	Name    string    `xg:"name"`
+	Title   string    `xg:"info>title"`
+	Authors []string  `xg:"info>author"`
+	Servers []Server  `xg:"server"`
+	Backups []*Server `xg:"backup"`
+	Primary *Server   `xg:"primary"`
+	Ports   []uint16  `xg:"port"`
+	Enabled *bool     `xg:"enabled"`
+	Data    []byte    `xg:"data,omitempty"`
+	Origin  Point     `xg:"origin"`
+	Levels  []Level   `xg:"level"`
+	Extra   struct {
+		Max uint `xg:"max,attr"`
+	} `xg:"extra"`
+	Size    uint64 `xg:",chardata"`
+	Comment string `xg:",comment"`
+}
@@ -0,0 +1,4 @@
+// Package xsdtest checks the code generated by cmd/xsd-gen
+package xsdtest
+
+//go:generate go run ../../cmd/xsd-gen -pkg xsdtest -o schema_xsd.go schema.xsd
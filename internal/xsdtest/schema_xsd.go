@@ -0,0 +1,180 @@
+// Code generated by xsd-gen -pkg xsdtest schema.xsd; DO NOT EDIT.
+
+package xsdtest
+
+import (
+	"fmt"
+
+	xg "github.com/adnsv/xmlgo"
+)
+
+// Status is the processing state of an order
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusShipped Status = "shipped"
+	StatusOnHold  Status = "on-hold"
+)
+
+// Valid reports whether v is one of the enumerated values
+func (v Status) Valid() bool {
+	switch v {
+	case StatusPending, StatusShipped, StatusOnHold:
+		return true
+	}
+	return false
+}
+
+func (v *Status) UnmarshalText(b []byte) error {
+	if !Status(b).Valid() {
+		return fmt.Errorf("invalid Status %q", b)
+	}
+	*v = Status(b)
+	return nil
+}
+
+type Priority uint8
+
+const (
+	Priority1 Priority = 1
+	Priority2 Priority = 2
+	Priority3 Priority = 3
+)
+
+// Valid reports whether v is one of the enumerated values
+func (v Priority) Valid() bool {
+	switch v {
+	case Priority1, Priority2, Priority3:
+		return true
+	}
+	return false
+}
+
+func (v *Priority) UnmarshalText(b []byte) error {
+	x, err := xg.ParseUint(string(b), 8)
+	if err != nil || !Priority(x).Valid() {
+		return fmt.Errorf("invalid Priority %q", b)
+	}
+	*v = Priority(x)
+	return nil
+}
+
+type Sku string
+
+type Address struct {
+	Name    string   `xg:"name"`
+	Street  []string `xg:"street"`
+	City    string   `xg:"city"`
+	Zip     string   `xg:"zip,omitempty"`
+	Country string   `xg:"country,attr"`
+}
+
+type USAddress struct {
+	Address
+	State string `xg:"state"`
+}
+
+type Price struct {
+	Value    float64 `xg:",chardata"`
+	Currency string  `xg:"currency,attr,omitempty"`
+}
+
+type Pickup struct {
+	Store string `xg:"store,attr"`
+}
+
+type Courier string
+
+// PurchaseOrderChoice is one of Courier, Pickup
+type PurchaseOrderChoice interface {
+	isPurchaseOrderChoice()
+}
+
+func (Courier) isPurchaseOrderChoice() {}
+func (Pickup) isPurchaseOrderChoice()  {}
+
+type PurchaseOrder struct {
+	ShipTo    USAddress           `xg:"shipTo"`
+	BillTo    *Address            `xg:"billTo"`
+	Choice    PurchaseOrderChoice `xg:"courier"`
+	Comment   string              `xg:"comment,omitempty"`
+	Items     PurchaseOrderItems  `xg:"items"`
+	OrderDate string              `xg:"orderDate,attr,omitempty"`
+	Status    Status              `xg:"status,attr"`
+	Priority  *Priority           `xg:"priority,attr"`
+	Created   string              `xg:"created,attr,omitempty"`
+	Revision  *int32              `xg:"revision,attr"`
+}
+
+type PurchaseOrderItems struct {
+	Item []PurchaseOrderItemsItem `xg:"item"`
+}
+
+type PurchaseOrderItemsItem struct {
+	ProductName string                         `xg:"productName"`
+	Quantity    PurchaseOrderItemsItemQuantity `xg:"quantity"`
+	Price       Price                          `xg:"price"`
+	ShipDate    string                         `xg:"shipDate,omitempty"`
+	PartNum     Sku                            `xg:"partNum,attr"`
+	Gift        *bool                          `xg:"gift,attr"`
+}
+
+type PurchaseOrderItemsItemQuantity uint64
+
+type Note struct {
+	B    []string `xg:"b"`
+	Text string   `xg:",chardata"`
+}
+
+// DecodePurchaseOrder decodes a document with the <purchaseOrder> root element
+func DecodePurchaseOrder(buf string) (*PurchaseOrder, error) {
+	ci := xg.Open(buf)
+	ci.SetRegistry(Registry)
+	v := new(PurchaseOrder)
+	if err := ci.Decode(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// EncodePurchaseOrder writes v as the <purchaseOrder> root element
+// and returns the first error of w
+func EncodePurchaseOrder(w *xg.Writer, v *PurchaseOrder) error {
+	w.SetRegistry(Registry)
+	w.OTag("purchaseOrder")
+	w.StringAttr("xmlns", "urn:example:po")
+	w.Write(v)
+	w.CTag()
+	return w.Err()
+}
+
+// DecodeNote decodes a document with the <note> root element
+func DecodeNote(buf string) (*Note, error) {
+	ci := xg.Open(buf)
+	ci.SetRegistry(Registry)
+	v := new(Note)
+	if err := ci.Decode(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// EncodeNote writes v as the <note> root element
+// and returns the first error of w
+func EncodeNote(w *xg.Writer, v *Note) error {
+	w.SetRegistry(Registry)
+	w.OTag("note")
+	w.StringAttr("xmlns", "urn:example:po")
+	w.Write(v)
+	w.CTag()
+	return w.Err()
+}
+
+// Registry maps the elements of choices to their Go types
+var Registry = xg.NewTypeRegistry()
+
+func init() {
+	Registry.Register("courier", (*Courier)(nil))
+	Registry.Register("pickup", (*Pickup)(nil))
+}
@@ -0,0 +1,93 @@
+package xsdtest
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	xg "github.com/adnsv/xmlgo"
+)
+
+const order = `<?xml version="1.0" encoding="UTF-8"?>
+<purchaseOrder xmlns="urn:example:po" orderDate="1999-10-20" status="on-hold" priority="2" revision="3">
+	<shipTo country="US">
+		<name>Alice Smith</name>
+		<street>123 Maple Street</street>
+		<street>Apt 4</street>
+		<city>Mill Valley</city>
+		<state>CA</state>
+	</shipTo>
+	<pickup store="downtown"/>
+	<items>
+		<item partNum="872-AA" gift="true">
+			<productName>Lawnmower</productName>
+			<quantity>1</quantity>
+			<price currency="EUR">148.95</price>
+		</item>
+		<item partNum="926-AA">
+			<productName>Baby Monitor</productName>
+			<quantity>2</quantity>
+			<price>39.98</price>
+			<shipDate>1999-05-21</shipDate>
+		</item>
+	</items>
+</purchaseOrder>`
+
+func TestDecode(t *testing.T) {
+	po, err := DecodePurchaseOrder(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if po.Status != StatusOnHold || po.Priority == nil || *po.Priority != Priority2 || *po.Revision != 3 {
+		t.Errorf("attributes: %+v", po)
+	}
+	if po.ShipTo.Country != "US" || len(po.ShipTo.Street) != 2 || po.ShipTo.State != "CA" || po.BillTo != nil {
+		t.Errorf("shipTo: %+v", po.ShipTo)
+	}
+	if p, ok := po.Choice.(Pickup); !ok || p.Store != "downtown" {
+		t.Errorf("choice: %#v", po.Choice)
+	}
+	items := po.Items.Item
+	if len(items) != 2 || items[0].Price.Value != 148.95 || items[0].Price.Currency != "EUR" ||
+		*items[0].Gift != true || items[1].Quantity != 2 || items[1].ShipDate != "1999-05-21" {
+		t.Errorf("items: %+v", items)
+	}
+
+	for buf, want := range map[string]string{
+		`<purchaseOrder status="lost"/>`: `xml decoder [1:16] /purchaseOrder/@status: invalid Status "lost"`,
+		`<purchaseOrder priority="7"/>`:  `xml decoder [1:16] /purchaseOrder/@priority: invalid Priority "7"`,
+		`<purchaseOrder priority="x"/>`:  `xml decoder [1:16] /purchaseOrder/@priority: invalid Priority "x"`,
+	} {
+		if _, err = DecodePurchaseOrder(buf); err == nil || err.Error() != want {
+			t.Errorf("got %v\nwant %s", err, want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, po := range []*PurchaseOrder{
+		{Status: StatusPending, Choice: Courier("ACME")},
+		{Status: StatusShipped, BillTo: &Address{Name: "Bob", Country: "UK"}, Choice: Pickup{Store: "north"},
+			Items: PurchaseOrderItems{Item: []PurchaseOrderItemsItem{{ProductName: "Tea", Quantity: 3, PartNum: "100-AB"}}}},
+	} {
+		buf := &bytes.Buffer{}
+		if err := EncodePurchaseOrder(xg.NewWriter(buf), po); err != nil {
+			t.Fatal(err)
+		}
+		got, err := DecodePurchaseOrder(buf.String())
+		if err != nil {
+			t.Fatalf("%v\n%s", err, buf)
+		}
+		if !reflect.DeepEqual(got, po) {
+			t.Errorf("got  %+v\nwant %+v\n%s", got, po, buf)
+		}
+	}
+
+	note, err := DecodeNote(`<note xmlns="urn:example:po">a<b>bold</b>c</note>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note.Text != "ac" || len(note.B) != 1 || note.B[0] != "bold" {
+		t.Errorf("note: %+v", note)
+	}
+}
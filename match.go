@@ -0,0 +1,264 @@
+package xg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Matcher streams over the content and invokes handlers for elements that
+// match simple path patterns. Elements that can not match any of the patterns
+// are skipped without being parsed.
+//
+// Supported pattern syntax:
+//
+//	/feed/entry/title     child steps from the document root
+//	//title               title elements at any depth
+//	entry/title           relative patterns are matched at any depth
+//	/feed/*/title         any element name
+//	//entry[@type]        attribute is present
+//	//entry[@type='x']    attribute value equals 'x', also [@type!='x']
+//
+// When an element matches, it is handed over to the handler together with
+// its content. Its descendants are not searched for further matches. When
+// several patterns match the same element, the one registered first wins.
+type Matcher struct {
+	patterns []*matchPattern
+}
+
+type matchPattern struct {
+	src     string
+	steps   []matchStep
+	handler TagHandler
+}
+
+type matchStep struct {
+	descendant bool       // step may match at any depth below the previous one
+	name       NameString // "*" matches any element
+	preds      []matchPred
+}
+
+type matchPred struct {
+	attr  NameString
+	op    string // "" (exists), "=", or "!="
+	value string
+}
+
+type matchState struct {
+	pattern int
+	step    int
+}
+
+func NewMatcher() *Matcher {
+	return &Matcher{}
+}
+
+// Handle registers a handler for elements that match the pattern
+func (m *Matcher) Handle(pattern string, handler TagHandler) error {
+	steps, err := compileMatchPattern(pattern)
+	if err != nil {
+		return err
+	}
+	m.patterns = append(m.patterns, &matchPattern{src: pattern, steps: steps, handler: handler})
+	return nil
+}
+
+// Match runs the matcher over the whole document
+func (m *Matcher) Match(buf string) error {
+	return m.Run(Open(buf))
+}
+
+// Run runs the matcher over the remaining content, patterns are evaluated
+// relative to the element that owns the content
+func (m *Matcher) Run(ci *Content) error {
+	states := make([]matchState, len(m.patterns))
+	for i := range m.patterns {
+		states[i] = matchState{pattern: i}
+	}
+	m.walk(ci, states)
+	return ci.Err()
+}
+
+func (m *Matcher) walk(ci *Content, states []matchState) {
+	for ci.NextTag() {
+		tag := ci.t
+		if !m.mayMatch(states, tag.Name) {
+			ci.HandleTag(nil)
+			continue
+		}
+		ci.HandleTag(func(attrs AttributeList, content *Content) error {
+			var next []matchState
+			matched := -1
+			for _, s := range states {
+				step := &m.patterns[s.pattern].steps[s.step]
+				if step.descendant {
+					next = appendMatchState(next, s)
+				}
+				if !step.matches(tag.Name, attrs) {
+					continue
+				}
+				if s.step+1 < len(m.patterns[s.pattern].steps) {
+					next = appendMatchState(next, matchState{s.pattern, s.step + 1})
+				} else if matched < 0 || s.pattern < matched {
+					matched = s.pattern
+				}
+			}
+			if matched >= 0 {
+				if h := m.patterns[matched].handler; h != nil {
+					return h(tag, attrs, content)
+				}
+				return nil
+			}
+			attrs.MarkHandled()
+			m.walk(content, next)
+			return content.Err()
+		})
+		if ci.err != nil {
+			return
+		}
+	}
+}
+
+func (m *Matcher) mayMatch(states []matchState, name NameString) bool {
+	for _, s := range states {
+		step := &m.patterns[s.pattern].steps[s.step]
+		if step.descendant || step.name == "*" || step.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func appendMatchState(states []matchState, s matchState) []matchState {
+	for _, v := range states {
+		if v == s {
+			return states
+		}
+	}
+	return append(states, s)
+}
+
+func (step *matchStep) matches(name NameString, attrs AttributeList) bool {
+	if step.name != "*" && step.name != name {
+		return false
+	}
+	for _, p := range step.preds {
+		v, ok := "", false
+		for _, a := range attrs {
+			if a.Name == p.attr {
+				v, ok = a.Value.Unscrambled(), true
+				break
+			}
+		}
+		switch p.op {
+		case "":
+			if !ok {
+				return false
+			}
+		case "=":
+			if !ok || v != p.value {
+				return false
+			}
+		case "!=":
+			if ok && v == p.value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func compileMatchPattern(pattern string) ([]matchStep, error) {
+	fail := func(msg string) ([]matchStep, error) {
+		return nil, fmt.Errorf("xml matcher: invalid pattern %q: %s", pattern, msg)
+	}
+
+	s := pattern
+	descendant := true
+	if strings.HasPrefix(s, "//") {
+		s = s[2:]
+	} else if strings.HasPrefix(s, "/") {
+		s = s[1:]
+		descendant = false
+	}
+
+	var steps []matchStep
+	for {
+		step := matchStep{descendant: descendant}
+		n := 0
+		if strings.HasPrefix(s, "*") {
+			n = 1
+		} else {
+			for n < len(s) && isNameChar(s[n]) {
+				n++
+			}
+			if n == 0 || !isNameStart(s[0]) {
+				return fail("element name expected")
+			}
+		}
+		step.name = NameString(s[:n])
+		s = s[n:]
+
+		for strings.HasPrefix(s, "[") {
+			var pred matchPred
+			var ok bool
+			pred, s, ok = parseMatchPred(s)
+			if !ok {
+				return fail("invalid predicate")
+			}
+			step.preds = append(step.preds, pred)
+		}
+		steps = append(steps, step)
+
+		if s == "" {
+			return steps, nil
+		}
+		if strings.HasPrefix(s, "//") {
+			s = s[2:]
+			descendant = true
+		} else if strings.HasPrefix(s, "/") {
+			s = s[1:]
+			descendant = false
+		} else {
+			return fail("unexpected '" + s[:1] + "'")
+		}
+	}
+}
+
+// parseMatchPred parses [@name], [@name='value'] and [@name!='value']
+func parseMatchPred(s string) (pred matchPred, rest string, ok bool) {
+	if !strings.HasPrefix(s, "[@") {
+		return
+	}
+	s = s[2:]
+	n := 0
+	for n < len(s) && isNameChar(s[n]) {
+		n++
+	}
+	if n == 0 || !isNameStart(s[0]) {
+		return
+	}
+	pred.attr = NameString(s[:n])
+	s = s[n:]
+
+	if strings.HasPrefix(s, "!=") {
+		pred.op = "!="
+	} else if strings.HasPrefix(s, "=") {
+		pred.op = "="
+	}
+	if pred.op != "" {
+		s = s[len(pred.op):]
+		if s == "" || (s[0] != '\'' && s[0] != '"') {
+			return
+		}
+		e := strings.IndexByte(s[1:], s[0])
+		if e < 0 {
+			return
+		}
+		pred.value = s[1 : e+1]
+		s = s[e+2:]
+	}
+	if !strings.HasPrefix(s, "]") {
+		return
+	}
+	return pred, s[1:], true
+}
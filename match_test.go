@@ -0,0 +1,78 @@
+package xg
+
+import (
+	"strings"
+	"testing"
+)
+
+const feedExample = `<feed>
+	<title>Feed</title>
+	<entry type="post">
+		<title>First</title>
+		<author><name>A</name></author>
+	</entry>
+	<entry type="draft">
+		<title>Second</title>
+		<meta><title>Nested</title></meta>
+	</entry>
+	<entry>
+		<title>Third</title>
+	</entry>
+</feed>`
+
+func collectMatches(t *testing.T, patterns ...string) string {
+	t.Helper()
+	var got []string
+	m := NewMatcher()
+	for _, p := range patterns {
+		p := p
+		err := m.Handle(p, func(tag *Token, attrs AttributeList, content *Content) error {
+			s := string(tag.Name) + ":"
+			for content.Next() {
+				s += string(content.Value())
+			}
+			got = append(got, s)
+			return content.Err()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Match(feedExample); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(got, ",")
+}
+
+func TestMatcher(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		want     string
+	}{
+		{[]string{"/feed/entry/title"}, "title:First,title:Second,title:Third"},
+		{[]string{"/feed/title"}, "title:Feed"},
+		{[]string{"//title"}, "title:Feed,title:First,title:Second,title:Nested,title:Third"},
+		{[]string{"entry//title"}, "title:First,title:Second,title:Nested,title:Third"},
+		{[]string{"/feed/*/title"}, "title:First,title:Second,title:Third"},
+		{[]string{"/feed/entry[@type]/title"}, "title:First,title:Second"},
+		{[]string{"/feed/entry[@type='draft']//title"}, "title:Second,title:Nested"},
+		{[]string{"/feed/entry[@type!='draft']/title"}, "title:First,title:Third"},
+		{[]string{"//author/name", "/feed/entry/author"}, "author:"},
+		{[]string{"/entry"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.patterns, "|"), func(t *testing.T) {
+			if got := collectMatches(t, tt.patterns...); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatcherInvalidPatterns(t *testing.T) {
+	for _, p := range []string{"", "/", "/a/", "/a[b]", "/a[@b=c]", "/a[@b='c'", "/a b"} {
+		if err := NewMatcher().Handle(p, nil); err == nil {
+			t.Errorf("%q: expected error", p)
+		}
+	}
+}
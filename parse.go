@@ -2,7 +2,6 @@ package xg
 
 import (
 	"errors"
-	"fmt"
 )
 
 func ParseTokens(buf string, ontoken func(t *Token) error) error {
@@ -29,26 +28,66 @@ type AttributeList []*Token
 func (aa AttributeList) Attr(name string) (string, bool) {
 	for _, a := range aa {
 		if string(a.Name) == name {
+			a.handled = true
 			return a.Value.Unscrambled(), true
 		}
 	}
 	return "", false
 }
 
+// MarkHandled marks the named attributes as handled, so that strict mode does
+// not report them. When called without arguments, all attributes are marked.
+func (aa AttributeList) MarkHandled(names ...string) {
+	for _, a := range aa {
+		if len(names) == 0 {
+			a.handled = true
+			continue
+		}
+		for _, n := range names {
+			if string(a.Name) == n {
+				a.handled = true
+			}
+		}
+	}
+}
+
+// Unhandled returns attributes that were neither read with Attr nor marked
+// with MarkHandled
+func (aa AttributeList) Unhandled() AttributeList {
+	var ret AttributeList
+	for _, a := range aa {
+		if !a.handled {
+			ret = append(ret, a)
+		}
+	}
+	return ret
+}
+
 type ContentHandler = func(t *Token) error
 type TagHandler func(tag *Token, attrs AttributeList, content *Content) error
 
 type Content struct {
 	tt       *tokenizer
+	doc      *docState
 	t        *Token
 	err      error
 	finished bool
 	locked   bool
+
+	parent   *Content
+	name     NameString    // name of the element that owns this content
+	attrs    AttributeList // attributes of the element that owns this content
+	index    int           // one-based index among same-named siblings
+	counts   map[NameString]int
+	tagIndex int // sibling index of the current tag
 }
 
 var ErrNoMoreContent = errors.New("no more content available")
 
 func (ci *Content) Err() error {
+	if ci == nil {
+		return nil
+	}
 	return ci.err
 }
 
@@ -62,10 +101,24 @@ func (ci *Content) Next() (ok bool) {
 	}
 
 	if ci.t != nil && ci.t.Kind == Tag {
-		skipTag(ci.tt)
+		// the tag was not handled by the caller
+		t := ci.t
+		ci.t = nil
+		index := ci.tagIndex
+		if err := skipTag(ci.tt); err != nil {
+			ci.err = err
+			return false
+		}
+		ci.reportUnhandled(t, func() string { return ci.childPath(t.Name, index) })
+		if ci.err != nil {
+			return false
+		}
 	}
 
 	ci.t = ci.tt.Next()
+	if ci.t.Kind == Tag {
+		ci.countTag(ci.t)
+	}
 
 	switch ci.t.Kind {
 	case Err:
@@ -84,8 +137,6 @@ func (ci *Content) Next() (ok bool) {
 		ci.t = nil
 		return false
 	}
-	// we should not end up being here
-	panic("unexpected token " + ci.t.Kind.String())
 }
 
 func (ci *Content) NextTag() bool {
@@ -143,11 +194,10 @@ func (ci *Content) IsPI() bool {
 	return ci.t != nil && ci.t.Kind == PI
 }
 func (ci *Content) MakeError(prefix, msg string) error {
-	line, pos := CalcLocation(ci.tt.buf, ci.tt.cur)
-	if prefix == "" {
-		prefix = "xml parser"
+	if ci == nil || ci.tt == nil {
+		return ci.makeErrorAt(0, prefix, msg)
 	}
-	return fmt.Errorf("%s [%d:%d]: %s", prefix, line+1, pos+1, msg)
+	return ci.makeErrorAt(ci.tt.cur, prefix, msg)
 }
 func (ci *Content) HandleTag(callback func(attrs AttributeList, content *Content) error) {
 	if ci == nil || ci.t == nil || ci.t.Kind != Tag {
@@ -164,6 +214,9 @@ func (ci *Content) HandleTag(callback func(attrs AttributeList, content *Content
 		return
 	}
 
+	name, index := ci.t.Name, ci.tagIndex
+	tagPath := func() string { return ci.childPath(name, index) }
+
 	// collect attributes
 	var t *Token
 	attrs := AttributeList{}
@@ -177,13 +230,17 @@ func (ci *Content) HandleTag(callback func(attrs AttributeList, content *Content
 	}
 	if t.IsError() {
 		ci.t = nil
-		ci.err = t.Error
+		ci.err = wrapPathError(t.Error, tagPath())
 		return
 	}
 
 	if t.Kind == CloseEmptyTag {
 		ci.t = nil
-		ci.err = callback(attrs, nil)
+		if err := callback(attrs, nil); err != nil {
+			ci.err = wrapPathError(err, tagPath())
+			return
+		}
+		ci.checkAttrs(attrs, tagPath)
 		return
 	}
 
@@ -191,28 +248,46 @@ func (ci *Content) HandleTag(callback func(attrs AttributeList, content *Content
 	defer func() { ci.locked = false; ci.t = nil }()
 
 	if t.Kind == BeginContent {
-		content := &Content{tt: ci.tt}
+		content := &Content{tt: ci.tt, doc: ci.doc, parent: ci, name: name, attrs: attrs, index: index}
 		err := callback(attrs, content)
+		if err == nil {
+			err = content.err
+		}
 		if err != nil {
-			ci.err = err
+			ci.err = wrapPathError(err, content.Path())
 			return
 		}
-		if content.finished {
+		ci.checkAttrs(attrs, content.Path)
+		if ci.err != nil || content.finished {
 			return
 		}
 
+		// a child tag the callback advanced to without handling it
+		pending := content.t != nil && content.t.Kind == Tag
 		for {
-			t = ci.tt.Next()
+			if pending {
+				t, pending, content.t = content.t, false, nil
+			} else {
+				t = ci.tt.Next()
+				if t.Kind == Tag {
+					content.countTag(t)
+				}
+			}
 			switch t.Kind {
 			case EndContent:
 				return
 			case Err:
-				ci.err = t.Error
+				ci.err = wrapPathError(t.Error, content.Path())
 				return
 			case Tag:
+				index := content.tagIndex
 				err := skipTag(ci.tt)
 				if err != nil {
-					ci.err = t.Error
+					ci.err = wrapPathError(err, content.Path())
+					return
+				}
+				ci.reportUnhandled(t, func() string { return content.childPath(t.Name, index) })
+				if ci.err != nil {
 					return
 				}
 				continue
@@ -234,7 +309,6 @@ func (ci *Content) HandleTag(callback func(attrs AttributeList, content *Content
 // returns empty string.
 //
 // This is useful for parsing <tag>string-content</tag> nodes
-//
 func (ci *Content) ChildStringContent() RawString {
 	if ci == nil || ci.t == nil || ci.t.Kind != Tag {
 		return ""
@@ -243,59 +317,26 @@ func (ci *Content) ChildStringContent() RawString {
 		panic("outer content is locked while handling child tags")
 	}
 
-	var t *Token
-	for {
-		// all attributes are ignored
-		t = ci.tt.Next()
-		if t.Kind != Attrib {
-			break
-		}
-	}
-
-	if t.Kind == CloseEmptyTag {
-		return ""
-	}
-	if t.Kind == BeginContent {
-		t = ci.tt.Next()
-		if t.Kind == SData {
-			ret := t.Value
-			t = ci.tt.Next()
-			if t.Kind == EndContent {
-				ci.t = nil
-				return ret
+	var ret RawString
+	ci.HandleTag(func(attrs AttributeList, content *Content) error {
+		// all attributes are ignored, child nodes are skipped
+		n := 0
+		for content.Next() {
+			n++
+			if n == 1 && content.IsSData() {
+				ret = content.Value()
 			}
 		}
-		// skip the rest of child nodes
-		for {
-			t = ci.tt.Next()
-			switch t.Kind {
-			case EndContent, EOF:
-				ci.t = nil
-				return ""
-			case Err:
-				ci.err = t.Error
-				return ""
-			case Tag:
-				err := skipTag(ci.tt)
-				if err != nil {
-					ci.err = t.Error
-					return ""
-				}
-				continue
-			case SData, CData, Comment, PI:
-				continue
-			}
-			// we should not end up being here
-			panic("unexpected token " + t.Kind.String())
+		if n != 1 {
+			ret = ""
 		}
-	}
-
-	// we should not end up being here
-	panic("unexpected token " + t.Kind.String())
+		return content.Err()
+	})
+	return ret
 }
 
 func Open(buf string) *Content {
-	return &Content{tt: &tokenizer{buf: buf}}
+	return &Content{tt: &tokenizer{buf: buf}, doc: &docState{}}
 }
 
 func skipTag(tt *tokenizer) error {
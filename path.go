@@ -0,0 +1,109 @@
+package xg
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Path returns the path of the element that owns this content, for example
+// "/project/targets/target[3]/step[2]". Sibling indexes are one-based and
+// omitted for the first element with a given name. Document level content
+// reports "/".
+func (ci *Content) Path() string {
+	if ci == nil || ci.parent == nil {
+		return "/"
+	}
+	var steps []string
+	for c := ci; c.parent != nil; c = c.parent {
+		steps = append(steps, pathStep(c.name, c.index))
+	}
+	var b strings.Builder
+	for i := len(steps) - 1; i >= 0; i-- {
+		b.WriteByte('/')
+		b.WriteString(steps[i])
+	}
+	return b.String()
+}
+
+func pathStep(name NameString, index int) string {
+	if index > 1 {
+		return string(name) + "[" + strconv.Itoa(index) + "]"
+	}
+	return string(name)
+}
+
+func joinPath(path, step string) string {
+	if strings.HasSuffix(path, "/") {
+		return path + step
+	}
+	return path + "/" + step
+}
+
+func (ci *Content) childPath(name NameString, index int) string {
+	return joinPath(ci.Path(), pathStep(name, index))
+}
+
+func (ci *Content) countTag(t *Token) {
+	if ci.counts == nil {
+		ci.counts = map[NameString]int{}
+	}
+	ci.counts[t.Name]++
+	ci.tagIndex = ci.counts[t.Name]
+}
+
+// ContentError is a located error produced with Content.MakeError
+type ContentError struct {
+	Prefix string
+	Path   string // element path, see Content.Path
+	Offset int    // offset within the original buffer
+	Line   int
+	Pos    int
+	Msg    string
+}
+
+func (e *ContentError) Error() string {
+	if e.Path == "" || e.Path == "/" {
+		return fmt.Sprintf("%s [%d:%d]: %s", e.Prefix, e.Line+1, e.Pos+1, e.Msg)
+	}
+	return fmt.Sprintf("%s [%d:%d] %s: %s", e.Prefix, e.Line+1, e.Pos+1, e.Path, e.Msg)
+}
+
+// PathError annotates errors returned from HandleTag callbacks with the path
+// of the element being handled
+type PathError struct {
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// wrapPathError annotates err with the path unless it already carries one
+func wrapPathError(err error, path string) error {
+	var pe *PathError
+	var ce *ContentError
+	var ue *UnhandledError
+	if errors.As(err, &pe) || errors.As(err, &ce) || errors.As(err, &ue) {
+		return err
+	}
+	return &PathError{Path: path, Err: err}
+}
+
+func (ci *Content) makeErrorAt(offset int, prefix, msg string) error {
+	if prefix == "" {
+		prefix = "xml parser"
+	}
+	if ci == nil || ci.tt == nil {
+		return fmt.Errorf("%s: %s", prefix, msg)
+	}
+	e := &ContentError{Prefix: prefix, Path: ci.Path(), Offset: offset, Msg: msg}
+	e.Line, e.Pos = CalcLocation(ci.tt.buf, offset)
+	return e
+}
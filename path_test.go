@@ -0,0 +1,83 @@
+package xg
+
+import (
+	"errors"
+	"testing"
+)
+
+const pathExample = `<project>
+	<targets>
+		<target/>
+		<target/>
+		<target>
+			<step/>
+			<step timeout="x"/>
+		</target>
+	</targets>
+</project>`
+
+func TestContentPath(t *testing.T) {
+	var paths []string
+	var walk func(content *Content)
+	walk = func(content *Content) {
+		if content == nil {
+			return
+		}
+		paths = append(paths, content.Path())
+		for content.NextTag() {
+			content.HandleTag(func(attrs AttributeList, content *Content) error {
+				walk(content)
+				return nil
+			})
+		}
+	}
+	walk(Open(pathExample))
+	want := []string{
+		"/",
+		"/project",
+		"/project/targets",
+		"/project/targets/target[3]",
+	}
+	if len(paths) != len(want) {
+		t.Fatalf("got %v, want %v", paths, want)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("path %d = %q, want %q", i, paths[i], want[i])
+		}
+	}
+}
+
+func TestErrorPath(t *testing.T) {
+	errTimeout := errors.New("invalid timeout")
+	var walk func(content *Content) error
+	walk = func(content *Content) error {
+		for content.NextTag() {
+			content.HandleTag(func(attrs AttributeList, content *Content) error {
+				if _, ok := attrs.Attr("timeout"); ok {
+					return errTimeout
+				}
+				return walk(content)
+			})
+		}
+		return content.Err()
+	}
+
+	err := walk(Open(pathExample))
+	if !errors.Is(err, errTimeout) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "/project/targets/target[3]/step[2]: invalid timeout"; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+
+	cc := Open(pathExample)
+	cc.NextTag()
+	cc.HandleTag(func(attrs AttributeList, content *Content) error {
+		content.NextTag()
+		return content.MakeError("", "bad targets")
+	})
+	if want := "xml parser [2:10] /project: bad targets"; cc.Err() == nil || cc.Err().Error() != want {
+		t.Errorf("got %v, want %q", cc.Err(), want)
+	}
+}
@@ -0,0 +1,486 @@
+package xg
+
+import (
+	"encoding"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	attrUnmarshalerType = reflect.TypeOf((*AttrUnmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Unmarshaler is implemented by types that decode their own element layout,
+// it is the counterpart of Marshaler. The content is nil for empty elements.
+type Unmarshaler interface {
+	UnmarshalXG(attrs AttributeList, content *Content) error
+}
+
+// AttrUnmarshaler is implemented by types that decode themselves from
+// attributes, it is the counterpart of AttrMarshaler. The name is the
+// attribute name of the field, an implementation may read any number of
+// attributes from the list.
+type AttrUnmarshaler interface {
+	UnmarshalXGAttr(name string, attrs AttributeList) error
+}
+
+// Unmarshal decodes the root element of the document into v, which must be a
+// non-nil pointer.
+//
+// Structs are decoded according to the xg field tags:
+//
+//	Field T                   // child element named "Field"
+//	Field T `xg:"name"`       // child element
+//	Field T `xg:"a>b>name"`   // child element nested in <a><b>
+//	Field T `xg:",any"`       // child elements not matched by other fields
+//	Field T `xg:"name,attr"`  // attribute
+//	Field T `xg:",chardata"`  // character data
+//	Field T `xg:",cdata"`     // character data, written as a CDATA section
+//	Field T `xg:",innerxml"`  // raw content of the element
+//	Field T `xg:",comment"`   // comments
+//	Field T `xg:"-"`          // ignored
+//
+// Repeated child elements are appended to slice fields, embedded structs are
+// decoded as if their fields belonged to the outer struct. An XMLName field
+// receives the element name, its tag name is checked when set. Fields without
+// xg tags use encoding/xml tags when present. Other values are
+// decoded from character data, either with encoding.TextUnmarshaler or by
+// parsing basic types. Types that implement Unmarshaler decode themselves.
+//
+// Interface values are decoded into the type registered for the element name,
+// see TypeRegistry. Element fields of interface type also match elements that
+// are registered with a type implementing the interface.
+func Unmarshal(buf string, v interface{}) error {
+	return Open(buf).Decode(v)
+}
+
+// Decode decodes content into v, which must be a non-nil pointer.
+//
+// At the document level, Decode finds the root element and decodes it along
+// with its attributes. Within an element, the remaining content is decoded,
+// starting with the current tag if it was not handled yet. The nil content
+// of empty elements decodes as empty text.
+func (ci *Content) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("xml decoder: Decode requires a non-nil pointer")
+	}
+	if ci == nil {
+		ev := allocPtr(rv.Elem())
+		if canUnmarshal(ev) {
+			return ev.Addr().Interface().(Unmarshaler).UnmarshalXG(nil, nil)
+		}
+		return setText(ev, "")
+	}
+	if ci.parent != nil {
+		if err := ci.decodeContent(rv.Elem()); err != nil {
+			return err
+		}
+		return ci.Err()
+	}
+
+	if !ci.IsTag() && !ci.NextTag() {
+		if err := ci.Err(); err != nil {
+			return err
+		}
+		return ci.MakeError("xml decoder", "missing root element")
+	}
+	ci.handleDecode(rv.Elem(), false)
+	return ci.Err()
+}
+
+// DecodeChild decodes the current child tag into v, which must be a non-nil
+// pointer. When v points to a slice, the decoded element is appended.
+func (ci *Content) DecodeChild(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("xml decoder: DecodeChild requires a non-nil pointer")
+	}
+	if !ci.IsTag() {
+		return errors.New("xml decoder: DecodeChild requires a current tag")
+	}
+	ev := rv.Elem()
+	ci.handleDecode(ev, ev.Kind() == reflect.Slice && ev.Type().Elem().Kind() != reflect.Uint8 && !canUnmarshal(ev))
+	return ci.Err()
+}
+
+// handleDecode decodes the current tag into v, or appends it to v when v is
+// a slice
+func (ci *Content) handleDecode(v reflect.Value, appendTo bool) {
+	tag, index := ci.t, ci.tagIndex
+	ci.HandleTag(func(attrs AttributeList, content *Content) error {
+		path := func() string { return ci.childPath(tag.Name, index) }
+		if !appendTo {
+			return ci.decodeElement(tag, attrs, content, v, path)
+		}
+		ev := reflect.New(v.Type().Elem()).Elem()
+		if err := ci.decodeElement(tag, attrs, content, ev, path); err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, ev))
+		return nil
+	})
+}
+
+// decodeElement decodes an element into v, content is nil for empty elements
+func (ci *Content) decodeElement(tag *Token, attrs AttributeList, content *Content, v reflect.Value, path func() string) error {
+	if v.Kind() == reflect.Interface {
+		return ci.decodeInterface(tag, attrs, content, v, path)
+	}
+	v = allocPtr(v)
+	if canUnmarshal(v) {
+		return v.Addr().Interface().(Unmarshaler).UnmarshalXG(attrs, content)
+	}
+	// namespace declarations are not reported in strict mode
+	attrs.MarkNamespaces()
+	if v.Kind() == reflect.Struct && !canUnmarshalText(v) {
+		ti, err := getTypeInfo(v.Type())
+		if err != nil {
+			return err
+		}
+		if ti.xmlname != nil {
+			if err := setXMLName(fieldByIndex(v, ti.xmlname.idx, true), ti.xmlname.name, tag.Name); err != nil {
+				return ci.decodeError(tag.SrcPos, path(), err)
+			}
+		}
+		for i := range ti.fields {
+			f := &ti.fields[i]
+			if f.flags&fAttr == 0 {
+				continue
+			}
+			if err := ci.decodeAttr(attrs, f.name, fieldByIndex(v, f.idx, true), path); err != nil {
+				return err
+			}
+		}
+	}
+	if content == nil {
+		if err := setText(v, ""); err != nil {
+			return ci.decodeError(ci.tt.cur, path(), err)
+		}
+		return nil
+	}
+	return content.decodeContent(v)
+}
+
+// decodeAttr decodes the named attribute into v, missing attributes leave v
+// unchanged
+func (ci *Content) decodeAttr(attrs AttributeList, name string, v reflect.Value, path func() string) error {
+	if ptrImplements(v.Type(), attrUnmarshalerType) {
+		u := allocPtr(v).Addr().Interface().(AttrUnmarshaler)
+		if err := u.UnmarshalXGAttr(name, attrs); err != nil {
+			offset := ci.tt.cur
+			if len(attrs) > 0 {
+				offset = attrs[0].SrcPos
+			}
+			for _, a := range attrs {
+				if string(a.Name) == name {
+					offset = a.SrcPos
+					break
+				}
+			}
+			return ci.decodeError(offset, joinPath(path(), "@"+name), err)
+		}
+		return nil
+	}
+	for _, a := range attrs {
+		if string(a.Name) != name {
+			continue
+		}
+		a.handled = true
+		if err := setText(v, a.Value.Unscrambled()); err != nil {
+			return ci.decodeError(a.SrcPos, joinPath(path(), "@"+name), err)
+		}
+		return nil
+	}
+	return nil
+}
+
+// decodeContent decodes the remaining content into v, Unmarshaler types
+// receive no attributes
+func (ci *Content) decodeContent(v reflect.Value) error {
+	v = allocPtr(v)
+	if canUnmarshal(v) {
+		return v.Addr().Interface().(Unmarshaler).UnmarshalXG(nil, ci)
+	}
+	if v.Kind() != reflect.Struct || canUnmarshalText(v) {
+		return ci.decodeText(v)
+	}
+	ti, err := getTypeInfo(v.Type())
+	if err != nil {
+		return err
+	}
+
+	var chardata, comments strings.Builder
+	textPos := -1
+	start := ci.tt.cur
+
+	handleCur := ci.IsTag()
+	for handleCur || ci.Next() {
+		handleCur = false
+		switch ci.Kind() {
+		case Tag:
+			ci.decodeTag(v, ti, nil)
+		case SData, CData:
+			if textPos < 0 {
+				textPos = ci.t.SrcPos
+			}
+			chardata.WriteString(ci.text())
+		case Comment:
+			comments.WriteString(string(ci.Value()))
+		}
+	}
+	if err := ci.Err(); err != nil {
+		return err
+	}
+
+	for i := range ti.fields {
+		f := &ti.fields[i]
+		switch f.flags & fMode {
+		case fCharData:
+			if err := setValue(ci, textPos, fieldByIndex(v, f.idx, true), chardata.String()); err != nil {
+				return err
+			}
+		case fComment:
+			if err := setValue(ci, start, fieldByIndex(v, f.idx, true), comments.String()); err != nil {
+				return err
+			}
+		case fInnerXML:
+			inner := ci.tt.buf[start:ci.tt.cur]
+			if ci.finished {
+				inner = inner[:strings.LastIndex(inner, "</")]
+			}
+			if err := setValue(ci, start, fieldByIndex(v, f.idx, true), inner); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// decodeText decodes the character data of the remaining content into v,
+// child elements are skipped
+func (ci *Content) decodeText(v reflect.Value) error {
+	s, textPos, err := ci.CharData()
+	if err != nil {
+		return err
+	}
+	return setValue(ci, textPos, v, s)
+}
+
+// text returns the decoded value of the current SData or CData token
+func (ci *Content) text() string {
+	if ci.Kind() == CData {
+		return string(ci.Value())
+	}
+	return ci.Value().Unscrambled()
+}
+
+// decodeTag decodes the current tag into the matching field of v. The
+// parents are the enclosing elements of a>b fields already entered.
+func (ci *Content) decodeTag(v reflect.Value, ti *typeInfo, parents []string) {
+	name := string(ci.Name())
+	f := ti.element(name, parents)
+	if f == nil {
+		f = ti.polymorphic(name, parents, ci.registry())
+	}
+	if f == nil && ti.isParent(name, parents) {
+		nested := append(parents[:len(parents):len(parents)], name)
+		ci.HandleTag(func(attrs AttributeList, content *Content) error {
+			for content.NextTag() {
+				content.decodeTag(v, ti, nested)
+			}
+			return content.Err()
+		})
+		return
+	}
+	if f == nil && parents == nil {
+		f = ti.any()
+	}
+	if f == nil {
+		return
+	}
+	fv := fieldByIndex(v, f.idx, true)
+	ci.handleDecode(fv, fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 && !canUnmarshal(fv))
+}
+
+func (ti *typeInfo) element(name string, parents []string) *fieldInfo {
+	for i := range ti.fields {
+		f := &ti.fields[i]
+		if f.flags&fElement != 0 && f.name == name && equalNames(f.parents, parents) {
+			return f
+		}
+	}
+	return nil
+}
+
+// polymorphic returns the interface field that can store the type registered
+// for the element name
+func (ti *typeInfo) polymorphic(name string, parents []string, r *TypeRegistry) *fieldInfo {
+	_, local := splitQName(NameString(name))
+	for i := range ti.fields {
+		f := &ti.fields[i]
+		if f.flags&fElement == 0 || !equalNames(f.parents, parents) {
+			continue
+		}
+		t := f.typ
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Interface && r.implements(local, t) {
+			return f
+		}
+	}
+	return nil
+}
+
+// isParent reports whether name is the next enclosing element of a>b fields
+func (ti *typeInfo) isParent(name string, parents []string) bool {
+	n := len(parents)
+	for i := range ti.fields {
+		f := &ti.fields[i]
+		if len(f.parents) > n && f.parents[n] == name && equalNames(f.parents[:n], parents) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ti *typeInfo) any() *fieldInfo {
+	for i := range ti.fields {
+		if ti.fields[i].flags&fAny != 0 {
+			return &ti.fields[i]
+		}
+	}
+	return nil
+}
+
+func equalNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+var xmlNameType = reflect.TypeOf(xml.Name{})
+
+// setXMLName checks the element name against the expected one and stores it
+// in the XMLName field
+func setXMLName(v reflect.Value, expected string, name NameString) error {
+	_, local := splitQName(name)
+	if expected != "" && expected != local && expected != string(name) {
+		return fmt.Errorf("expected element <%s>, found <%s>", expected, name)
+	}
+	switch {
+	case v.Type() == xmlNameType:
+		v.Set(reflect.ValueOf(xml.Name{Local: local}))
+	case v.Kind() == reflect.String:
+		v.SetString(string(name))
+	}
+	return nil
+}
+
+// setValue decodes s into v and reports errors at the given offset, a negative
+// offset refers to the current position
+func setValue(ci *Content, offset int, v reflect.Value, s string) error {
+	if err := setText(v, s); err != nil {
+		if offset < 0 {
+			offset = ci.tt.cur
+		}
+		return ci.decodeError(offset, ci.Path(), err)
+	}
+	return nil
+}
+
+func (ci *Content) decodeError(offset int, path string, err error) error {
+	e := &ContentError{Prefix: "xml decoder", Path: path, Offset: offset, Msg: err.Error()}
+	e.Line, e.Pos = CalcLocation(ci.tt.buf, offset)
+	return e
+}
+
+// allocPtr follows pointers, allocating nil ones
+func allocPtr(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// ptrImplements reports whether a pointer to the dereferenced type
+// implements the interface
+func ptrImplements(t reflect.Type, iface reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return reflect.PtrTo(t).Implements(iface)
+}
+
+func canUnmarshal(v reflect.Value) bool {
+	return v.CanAddr() && v.Addr().Type().Implements(unmarshalerType)
+}
+
+func canUnmarshalText(v reflect.Value) bool {
+	return v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType)
+}
+
+// setText decodes a character data or attribute value into v
+func setText(v reflect.Value, s string) error {
+	v = allocPtr(v)
+	if canUnmarshalText(v) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	badValue := func() error {
+		return fmt.Errorf("cannot decode %q into %s", s, v.Type())
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := ParseInt(s, v.Type().Bits())
+		if err != nil {
+			return badValue()
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := ParseUint(s, v.Type().Bits())
+		if err != nil {
+			return badValue()
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return badValue()
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := ParseBool(s)
+		if err != nil {
+			return badValue()
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return &UnsupportedTypeError{v.Type()}
+		}
+		v.SetBytes([]byte(s))
+	case reflect.Struct:
+		// structs without character data fields ignore text
+	default:
+		return &UnsupportedTypeError{v.Type()}
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package xg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type decodeLevel int
+
+func (l *decodeLevel) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "":
+		*l = 0
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return &UnsupportedTypeError{reflect.TypeOf(l)}
+	}
+	return nil
+}
+
+type decodeBase struct {
+	ID   string `xg:"id,attr"`
+	Note string `xg:"note"`
+}
+
+type decodeServer struct {
+	decodeBase
+	Port    int         `xg:"port,attr"`
+	Secure  *bool       `xg:"secure,attr"`
+	Level   decodeLevel `xg:"level,attr"`
+	Address string      `xg:",chardata"`
+}
+
+type decodeConfig struct {
+	Version float64         `xg:"version,attr"`
+	Name    string          `xg:"name"`
+	Servers []decodeServer  `xg:"server"`
+	Backups []*decodeServer `xg:"backup"`
+	Tags    []string        `xg:"tag"`
+	Limits  *struct {
+		Max  uint `xg:"max,attr"`
+		Text []byte
+	} `xg:"limits"`
+	Comments string `xg:",comment"`
+	Skipped  string `xg:"-"`
+	Raw      struct {
+		Inner string `xg:",innerxml"`
+	} `xg:"raw"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	buf := `<?xml version="1.0" encoding="UTF-8"?>
+<config version="1.5">
+	<!-- primary -->
+	<name>main &amp; only</name>
+	<server id="a" port="80" level="low">10.0.0.1<note>first</note></server>
+	<server id="b" port="81" secure="true" level="high"><![CDATA[10.0.0.2]]></server>
+	<backup id="c" port="82"/>
+	<tag>x</tag><tag>y</tag>
+	<limits max="10"><Text>abc</Text></limits>
+	<raw><a x='1'>t</a> &amp;</raw>
+	<unknown/>
+</config>`
+	var cfg decodeConfig
+	if err := Unmarshal(buf, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	yes := true
+	want := decodeConfig{
+		Version: 1.5,
+		Name:    "main & only",
+		Servers: []decodeServer{
+			{decodeBase: decodeBase{ID: "a", Note: "first"}, Port: 80, Level: 1, Address: "10.0.0.1"},
+			{decodeBase: decodeBase{ID: "b"}, Port: 81, Secure: &yes, Level: 2, Address: "10.0.0.2"},
+		},
+		Backups:  []*decodeServer{{decodeBase: decodeBase{ID: "c"}, Port: 82}},
+		Tags:     []string{"x", "y"},
+		Comments: " primary ",
+	}
+	want.Limits = cfg.Limits
+	want.Raw.Inner = `<a x='1'>t</a> &amp;`
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got  %+v\nwant %+v", cfg, want)
+	}
+	if cfg.Limits == nil || cfg.Limits.Max != 10 || string(cfg.Limits.Text) != "abc" {
+		t.Errorf("unexpected limits: %+v", cfg.Limits)
+	}
+}
+
+func TestContentDecode(t *testing.T) {
+	buf := `<root><count>3</count><item><name>a</name></item><item><name>b</name></item><item/><label/></root>`
+	type item struct {
+		Name string `xg:"name"`
+	}
+	var count int
+	label := "x"
+	var items []item
+	ci := Open(buf)
+	ci.NextTag()
+	ci.HandleTag(func(attrs AttributeList, content *Content) error {
+		for content.NextTag() {
+			switch content.Name() {
+			case "count":
+				content.HandleTag(func(attrs AttributeList, content *Content) error {
+					return content.Decode(&count)
+				})
+			case "item":
+				content.HandleTag(func(attrs AttributeList, content *Content) error {
+					var it item
+					err := content.Decode(&it)
+					items = append(items, it)
+					return err
+				})
+			case "label":
+				content.HandleTag(func(attrs AttributeList, content *Content) error {
+					return content.Decode(&label)
+				})
+			}
+		}
+		return content.Err()
+	})
+	if err := ci.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 || !reflect.DeepEqual(items, []item{{"a"}, {"b"}, {""}}) || label != "" {
+		t.Errorf("got %d %v %q", count, items, label)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  string
+		v    interface{}
+		err  string
+	}{
+		{"attr", "<config>\n  <server port='x'/>\n</config>", &decodeConfig{},
+			`xml decoder [2:11] /config/server/@port: cannot decode "x" into int`},
+		{"text", "<config><server/><server level='mid'/></config>", &decodeConfig{},
+			`xml decoder [1:26] /config/server[2]/@level: xml: unsupported type: *xg.decodeLevel`},
+		{"chardata", "<config version='1'>\n<limits max='1'><Text>a</Text></limits><tag>z</tag></config>", &struct {
+			Tags []int `xg:"tag"`
+		}{}, `xml decoder [2:45] /config/tag: cannot decode "z" into int`},
+		{"nil", "<a/>", nil, "xml decoder: Decode requires a non-nil pointer"},
+		{"tag", "<a/>", &struct {
+			A int `xg:"a,attr,chardata"`
+		}{}, `/a: xg: invalid tag "a,attr,chardata" on field A: conflicting flags`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Unmarshal(tt.buf, tt.v)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("got %v\nwant %s", err, tt.err)
+			}
+		})
+	}
+
+	// strict mode reports elements and attributes that have no fields
+	ci := Open(`<config version="1" extra="2"><name>n</name><unknown/></config>`)
+	ci.SetStrict(StrictWarn)
+	var cfg decodeConfig
+	if err := ci.Decode(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	var msgs []string
+	for _, w := range ci.Warnings() {
+		msgs = append(msgs, w.Error())
+	}
+	want := "xml parser [1:45] /config/unknown: unknown element 'unknown'; xml parser [1:21] /config/@extra: unknown attribute 'extra'"
+	if got := strings.Join(msgs, "; "); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+// decodeRange has a custom layout "min..max"
+type decodeRange struct {
+	Min, Max int
+}
+
+func (r decodeRange) MarshalXG(w *Writer) error {
+	w.String(fmt.Sprintf("%d..%d", r.Min, r.Max))
+	return nil
+}
+
+func (r *decodeRange) UnmarshalXG(attrs AttributeList, content *Content) error {
+	s := ""
+	for content.Next() {
+		if content.IsSData() {
+			s += content.Value().Unscrambled()
+		}
+	}
+	if _, err := fmt.Sscanf(s, "%d..%d", &r.Min, &r.Max); err != nil {
+		return content.MakeError("", "invalid range")
+	}
+	if step, ok := attrs.Attr("step"); ok {
+		r.Max *= len(step)
+	}
+	return content.Err()
+}
+
+func TestUnmarshaler(t *testing.T) {
+	type limits struct {
+		Ranges []decodeRange `xg:"range"`
+		Single *decodeRange  `xg:"single"`
+	}
+	in := limits{Ranges: []decodeRange{{1, 2}, {3, 4}}, Single: &decodeRange{5, 6}}
+	out := &bytes.Buffer{}
+	w := NewWriter(out)
+	w.OTag("limits")
+	w.Write(in)
+	w.CTag()
+	if got, want := out.String(), `<limits><range>1..2</range><range>3..4</range><single>5..6</single></limits>`; got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	var got limits
+	if err := Unmarshal(out.String(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("got %+v", got)
+	}
+
+	// DecodeChild passes attributes and appends to slices
+	ci := Open(`<r><range step="ab">1..2</range><range>3..4</range><range>bad</range></r>`)
+	ci.NextTag()
+	var ranges []decodeRange
+	ci.HandleTag(func(attrs AttributeList, content *Content) error {
+		for content.NextTag() {
+			if err := content.DecodeChild(&ranges); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err := ci.Err(); err == nil || err.Error() != "xml parser [1:70] /r/range[3]: invalid range" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(ranges, []decodeRange{{1, 4}, {3, 4}}) {
+		t.Errorf("got %+v", ranges)
+	}
+}
+
+// xmlCompat uses encoding/xml struct tags only
+type xmlCompat struct {
+	XMLName xml.Name `xml:"urn:test catalog"`
+	Lang    string   `xml:"lang,attr,omitempty"`
+	Title   string   `xml:"info>title"`
+	Authors []string `xml:"info>author"`
+	Year    int      `xml:"year,omitempty"`
+	Extra   []xmlAny `xml:",any"`
+}
+
+type xmlAny struct {
+	XMLName xml.Name
+	Text    string `xml:",chardata"`
+}
+
+func TestUnmarshalXMLTags(t *testing.T) {
+	buf := `<catalog lang="en"><info><title>T</title><author>a</author><author>b</author></info><isbn>1</isbn><note>n</note></catalog>`
+	var got xmlCompat
+	if err := Unmarshal(buf, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := xmlCompat{
+		XMLName: xml.Name{Local: "catalog"},
+		Lang:    "en",
+		Title:   "T",
+		Authors: []string{"a", "b"},
+		Extra:   []xmlAny{{xml.Name{Local: "isbn"}, "1"}, {xml.Name{Local: "note"}, "n"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+
+	out := &bytes.Buffer{}
+	w := NewWriter(out)
+	w.OTag("catalog")
+	w.Write(got)
+	w.CTag()
+	if out.String() != buf {
+		t.Errorf("got  %s\nwant %s", out.String(), buf)
+	}
+
+	err := Unmarshal(`<book/>`, &got)
+	if err == nil || err.Error() != "xml decoder [1:1] /book: expected element <catalog>, found <book>" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// xmlScript keeps its character data in a CDATA section
+type xmlScript struct {
+	XMLName xml.Name `xml:"script"`
+	Lang    string   `xml:"lang,attr"`
+	Code    string   `xml:",cdata"`
+}
+
+func TestUnmarshalXMLCData(t *testing.T) {
+	buf := `<script lang="js"><![CDATA[a < b && c]]></script>`
+	var got xmlScript
+	if err := Unmarshal(buf, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Lang != "js" || got.Code != "a < b && c" {
+		t.Errorf("got %+v", got)
+	}
+
+	out := &bytes.Buffer{}
+	w := NewWriter(out)
+	w.WriteElement("script", got)
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want, err := xml.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != string(want) {
+		t.Errorf("got  %s\nwant %s", out.String(), want)
+	}
+}
@@ -0,0 +1,186 @@
+package xg
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// TypeRegistry maps element names to Go types, it is used to decode elements
+// into interface values and to name the elements of interface values when
+// writing
+type TypeRegistry struct {
+	mu    sync.RWMutex
+	types map[regName]reflect.Type
+	names map[reflect.Type]regName
+}
+
+type regName struct {
+	uri   string
+	local string
+}
+
+// DefaultRegistry is used by Content and Writer unless another registry is
+// set with SetRegistry
+var DefaultRegistry = NewTypeRegistry()
+
+func NewTypeRegistry() *TypeRegistry {
+	return &TypeRegistry{
+		types: map[regName]reflect.Type{},
+		names: map[reflect.Type]regName{},
+	}
+}
+
+// Register maps the element name to the type of v. The name may be qualified
+// with a namespace URI separated with a space, as in "urn:shapes circle".
+// Unqualified names match elements in any namespace.
+//
+// Values are decoded into pointers when only the pointer type implements the
+// interface. Registering the same name or type twice panics.
+func (r *TypeRegistry) Register(name string, v interface{}) {
+	n := regName{local: name}
+	if i := strings.LastIndexByte(name, ' '); i >= 0 {
+		n.uri, n.local = name[:i], name[i+1:]
+	}
+	if n.local == "" || v == nil {
+		panic("xml registry: registering an empty name or a nil value")
+	}
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.types[n]; dup {
+		panic(fmt.Sprintf("xml registry: element name %q is already registered", name))
+	}
+	if _, dup := r.names[t]; dup {
+		panic(fmt.Sprintf("xml registry: type %s is already registered", t))
+	}
+	r.types[n] = t
+	r.names[t] = n
+}
+
+// RegisterType maps the element name to the type of v in DefaultRegistry
+func RegisterType(name string, v interface{}) {
+	DefaultRegistry.Register(name, v)
+}
+
+// lookup returns the type registered for the qualified name, falling back to
+// the unqualified one
+func (r *TypeRegistry) lookup(uri, local string) reflect.Type {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if t, ok := r.types[regName{uri, local}]; ok {
+		return t
+	}
+	return r.types[regName{local: local}]
+}
+
+// implements reports whether a type registered under the local name, in any
+// namespace, can be stored in a value of the interface type
+func (r *TypeRegistry) implements(local string, iface reflect.Type) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for n, t := range r.types {
+		if n.local == local && assignableTo(t, iface) {
+			return true
+		}
+	}
+	return false
+}
+
+// nameOf returns the name registered for the type or the type it points to
+func (r *TypeRegistry) nameOf(t reflect.Type) (regName, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n, ok := r.names[t]
+	return n, ok
+}
+
+// assignableTo reports whether t or a pointer to t implements the interface
+func assignableTo(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PtrTo(t).Implements(iface)
+}
+
+// SetRegistry sets the registry used to decode interface values for the whole
+// document this content belongs to
+func (ci *Content) SetRegistry(r *TypeRegistry) {
+	if ci == nil || ci.doc == nil {
+		return
+	}
+	ci.doc.registry = r
+}
+
+func (ci *Content) registry() *TypeRegistry {
+	if ci != nil && ci.doc != nil && ci.doc.registry != nil {
+		return ci.doc.registry
+	}
+	return DefaultRegistry
+}
+
+// SetRegistry sets the registry used to name the elements of interface values
+func (w *Writer) SetRegistry(r *TypeRegistry) {
+	w.registry = r
+}
+
+func (w *Writer) getRegistry() *TypeRegistry {
+	if w.registry != nil {
+		return w.registry
+	}
+	return DefaultRegistry
+}
+
+// lookupNamespace resolves the prefix with the declarations in attrs and in
+// the elements that own ci and its parents. An empty prefix looks up the
+// default namespace.
+func (ci *Content) lookupNamespace(attrs AttributeList, prefix string) string {
+	if prefix == "xml" {
+		return xmlNamespaceURI
+	}
+	name := NameString("xmlns")
+	if prefix != "" {
+		name += NameString(":" + prefix)
+	}
+	for {
+		for _, a := range attrs {
+			if a.Name == name {
+				return a.Value.Unscrambled()
+			}
+		}
+		if ci == nil {
+			return ""
+		}
+		attrs, ci = ci.attrs, ci.parent
+	}
+}
+
+// decodeInterface decodes an element into a new value of the type registered
+// for its name and stores it in the interface value v
+func (ci *Content) decodeInterface(tag *Token, attrs AttributeList, content *Content, v reflect.Value, path func() string) error {
+	prefix, local := splitQName(tag.Name)
+	t := ci.registry().lookup(ci.lookupNamespace(attrs, prefix), local)
+	if t == nil {
+		return ci.decodeError(tag.SrcPos, path(), fmt.Errorf("no type registered for element <%s>", tag.Name))
+	}
+	p := reflect.New(t)
+	var nv reflect.Value
+	switch {
+	case t.Implements(v.Type()):
+		nv = p.Elem()
+	case p.Type().Implements(v.Type()):
+		nv = p
+	default:
+		return ci.decodeError(tag.SrcPos, path(), fmt.Errorf("%s registered for <%s> does not implement %s", t, tag.Name, v.Type()))
+	}
+	if err := ci.decodeElement(tag, attrs, content, p.Elem(), path); err != nil {
+		return err
+	}
+	v.Set(nv)
+	return nil
+}
@@ -0,0 +1,93 @@
+package xg
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type regShape interface {
+	Area() float64
+}
+
+type regCircle struct {
+	R float64 `xg:"r,attr"`
+}
+
+func (c regCircle) Area() float64 { return 3 * c.R * c.R }
+
+type regRect struct {
+	W float64 `xg:"w,attr"`
+	H float64 `xg:"h,attr"`
+}
+
+func (r *regRect) Area() float64 { return r.W * r.H }
+
+type regDrawing struct {
+	Title  string     `xg:"title,attr"`
+	Shapes []regShape `xg:"shapes>shape"`
+	Main   regShape
+}
+
+func TestTypeRegistry(t *testing.T) {
+	r := NewTypeRegistry()
+	r.Register("circle", regCircle{})
+	r.Register("urn:shapes rect", &regRect{})
+
+	buf := `<drawing title="d" xmlns:s="urn:shapes"><shapes><circle r="1" /><s:rect w="2" h="3" /><rect xmlns="urn:shapes" w="4" h="5" /></shapes><circle r="2" /></drawing>`
+	ci := Open(buf)
+	ci.SetRegistry(r)
+	ci.SetStrict(StrictError)
+	var got regDrawing
+	if err := ci.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := regDrawing{
+		Title:  "d",
+		Shapes: []regShape{regCircle{1}, &regRect{2, 3}, &regRect{4, 5}},
+		Main:   regCircle{2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+
+	out := &bytes.Buffer{}
+	w := NewWriter(out)
+	w.SetRegistry(r)
+	w.OTag("drawing")
+	w.StringAttr("xmlns:s", "urn:shapes")
+	w.Write(want)
+	w.CTag()
+	wantOut := `<drawing xmlns:s="urn:shapes" title="d"><shapes><circle r="1" /><s:rect w="2" h="3" /><s:rect w="4" h="5" /></shapes><circle r="2" /></drawing>`
+	if out.String() != wantOut {
+		t.Errorf("got  %s\nwant %s", out.String(), wantOut)
+	}
+
+	// namespaces that are not in scope are declared on the element
+	out.Reset()
+	w = NewWriter(out)
+	w.SetRegistry(r)
+	w.SetPrefix("urn:shapes", "")
+	w.OTag("drawing")
+	w.Write(regDrawing{Main: &regRect{1, 2}})
+	w.CTag()
+	wantOut = `<drawing title=""><shapes /><rect xmlns="urn:shapes" w="1" h="2" /></drawing>`
+	if out.String() != wantOut {
+		t.Errorf("got  %s\nwant %s", out.String(), wantOut)
+	}
+
+	// rect is registered in another namespace
+	ci = Open(`<drawing><shapes><rect xmlns="urn:other"/></shapes></drawing>`)
+	ci.SetRegistry(r)
+	err := ci.Decode(&got)
+	if err == nil || err.Error() != "xml decoder [1:18] /drawing/shapes/rect: no type registered for element <rect>" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("duplicate registration did not panic")
+		}
+	}()
+	r.Register("disk", &regCircle{})
+}
@@ -0,0 +1,85 @@
+package xg
+
+import "fmt"
+
+// StrictMode controls how unhandled child elements and attributes are
+// reported while parsing content
+type StrictMode int
+
+const (
+	StrictOff   = StrictMode(iota) // unhandled items are silently skipped
+	StrictWarn                     // unhandled items are collected as warnings
+	StrictError                    // the first unhandled item fails parsing
+)
+
+// docState is shared by all the Content instances of a single document
+type docState struct {
+	strict   StrictMode
+	warnings []error
+	registry *TypeRegistry
+}
+
+// UnhandledError is reported in strict mode for elements that were skipped
+// without being handled and for attributes that were never read by a handler
+type UnhandledError struct {
+	Kind   TokenKind // Tag or Attrib
+	Name   NameString
+	Path   string // path to the unhandled element or attribute
+	Offset int    // offset within the original buffer
+	Line   int
+	Pos    int
+}
+
+func (e *UnhandledError) Error() string {
+	what := "element"
+	if e.Kind == Attrib {
+		what = "attribute"
+	}
+	return fmt.Sprintf("xml parser [%d:%d] %s: unknown %s '%s'", e.Line+1, e.Pos+1, e.Path, what, e.Name)
+}
+
+// SetStrict enables reporting of unhandled elements and attributes for the
+// whole document this content belongs to.
+//
+// An element is unhandled when it is skipped by Next or left unprocessed when
+// a HandleTag callback returns. Use HandleTag(nil) to skip an element
+// explicitly. An attribute is unhandled when it is neither read with
+// AttributeList.Attr nor marked with AttributeList.MarkHandled.
+func (ci *Content) SetStrict(mode StrictMode) {
+	if ci == nil || ci.doc == nil {
+		return
+	}
+	ci.doc.strict = mode
+}
+
+// Warnings returns unhandled items collected in StrictWarn mode
+func (ci *Content) Warnings() []error {
+	if ci == nil || ci.doc == nil {
+		return nil
+	}
+	return ci.doc.warnings
+}
+
+func (ci *Content) reportUnhandled(t *Token, path func() string) {
+	if ci.doc == nil || ci.doc.strict == StrictOff {
+		return
+	}
+	e := &UnhandledError{Kind: t.Kind, Name: t.Name, Path: path(), Offset: t.SrcPos}
+	e.Line, e.Pos = CalcLocation(ci.tt.buf, t.SrcPos)
+	if ci.doc.strict == StrictWarn {
+		ci.doc.warnings = append(ci.doc.warnings, e)
+	} else if ci.err == nil {
+		ci.err = e
+	}
+}
+
+func (ci *Content) checkAttrs(attrs AttributeList, elementPath func() string) {
+	if ci.doc == nil || ci.doc.strict == StrictOff {
+		return
+	}
+	for _, a := range attrs {
+		if !a.handled {
+			ci.reportUnhandled(a, func() string { return joinPath(elementPath(), "@"+string(a.Name)) })
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package xg
+
+import (
+	"errors"
+	"testing"
+)
+
+const strictExample = `<config version="2" verion="3">
+	<name>demo</name>
+	<port>80</port>
+	<prot>81</prot>
+	<opts flag="1" flga="2"/>
+	<ignored><x/></ignored>
+</config>`
+
+func parseStrictExample(mode StrictMode) (*Content, error) {
+	cc := Open(strictExample)
+	cc.SetStrict(mode)
+	for cc.NextTag() {
+		cc.HandleTag(func(attrs AttributeList, content *Content) error {
+			attrs.Attr("version")
+			for content.NextTag() {
+				switch content.Name() {
+				case "name", "port":
+					content.ChildStringContent()
+				case "opts":
+					content.HandleTag(func(attrs AttributeList, content *Content) error {
+						attrs.Attr("flag")
+						return nil
+					})
+				case "ignored":
+					content.HandleTag(nil)
+				}
+			}
+			return content.Err()
+		})
+	}
+	return cc, cc.Err()
+}
+
+func TestStrictOff(t *testing.T) {
+	cc, err := parseStrictExample(StrictOff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cc.Warnings()) != 0 {
+		t.Errorf("unexpected warnings: %v", cc.Warnings())
+	}
+}
+
+func TestStrictWarn(t *testing.T) {
+	cc, err := parseStrictExample(StrictWarn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"xml parser [4:2] /config/prot: unknown element 'prot'",
+		"xml parser [5:17] /config/opts/@flga: unknown attribute 'flga'",
+		"xml parser [1:21] /config/@verion: unknown attribute 'verion'",
+	}
+	got := cc.Warnings()
+	if len(got) != len(want) {
+		t.Fatalf("got %d warnings %v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if got[i].Error() != want[i] {
+			t.Errorf("warning %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestStrictError(t *testing.T) {
+	_, err := parseStrictExample(StrictError)
+	var ue *UnhandledError
+	if !errors.As(err, &ue) {
+		t.Fatalf("expected UnhandledError, got %v", err)
+	}
+	if ue.Kind != Tag || ue.Name != "prot" || ue.Line != 3 {
+		t.Errorf("unexpected error: %v", ue)
+	}
+}
+
+func TestChildStringContent(t *testing.T) {
+	cc := Open(`<a><id/><x>1</x><y></y><z>2<b/></z><w>3</w></a>`)
+	got := map[NameString]RawString{}
+	for cc.NextTag() {
+		cc.HandleTag(func(attrs AttributeList, content *Content) error {
+			for content.NextTag() {
+				got[content.Name()] = content.ChildStringContent()
+			}
+			return content.Err()
+		})
+	}
+	if cc.Err() != nil {
+		t.Fatal(cc.Err())
+	}
+	want := map[NameString]RawString{"id": "", "x": "1", "y": "", "z": "", "w": "3"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: got %q, want %q", k, got[k], v)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestStrictEarlyReturn(t *testing.T) {
+	cc := Open(`<a><b/><c><d/></c><e/></a>`)
+	cc.SetStrict(StrictWarn)
+	for cc.NextTag() {
+		cc.HandleTag(func(attrs AttributeList, content *Content) error {
+			for content.NextTag() {
+				if content.Name() == "c" {
+					return nil // leaves c pending
+				}
+				content.HandleTag(nil)
+			}
+			return content.Err()
+		})
+	}
+	if cc.Err() != nil {
+		t.Fatal(cc.Err())
+	}
+	want := []string{
+		"xml parser [1:8] /a/c: unknown element 'c'",
+		"xml parser [1:19] /a/e: unknown element 'e'",
+	}
+	got := cc.Warnings()
+	if len(got) != len(want) {
+		t.Fatalf("got %d warnings %v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if got[i].Error() != want[i] {
+			t.Errorf("warning %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -26,6 +26,9 @@ const (
 	ErrUnterminatedComment
 	ErrInvalidComment
 	ErrUnterminatedPI
+	ErrInvalidReference
+	ErrDuplicateAttribute
+	ErrCDataEndInText
 )
 
 var ecstr = map[ErrCode]string{
@@ -47,6 +50,9 @@ var ecstr = map[ErrCode]string{
 	ErrUnterminatedComment:    "unterminated comment",
 	ErrInvalidComment:         "invalid comment",
 	ErrUnterminatedPI:         "unterminated processing instruction",
+	ErrInvalidReference:       "invalid reference",
+	ErrDuplicateAttribute:     "duplicate attribute",
+	ErrCDataEndInText:         "]]> in character data",
 }
 
 func (ec ErrCode) String() string {
@@ -149,6 +155,8 @@ type Token struct {
 	WhitePrefix string
 	Raw         string
 	SrcPos      int
+
+	handled bool // attribute has been consumed by a handler
 }
 
 func (t *Token) IsError() bool {
@@ -247,27 +255,27 @@ func (tt *tokenizer) Next() *Token {
 			tt.skipWhite()
 		}
 		if tt.skipStr("<?xml") {
-			// xmlspec:XMLDecl
-			tt.skipWhite()
-			n, v, ec := tt.readAttrPair()
-			if ec == ErrCodeOk && n == "version" {
-				// xmlspec:VersionInfo
-				// ignore actual version number, should be '1.0' or '1.1'
-				tt.skipWhite()
-				n, v, ec = tt.readAttrPair()
-			}
-			if ec != ErrCodeOk {
-				return mkerr(ec)
-			}
-			if n != "encoding" {
-				return mkerr(ErrCodeInvalidXmlDecl)
-			}
-			tt.skipWhite()
-			if !tt.skipStr("?>") {
-				return mkerr(ErrCodeInvalidXmlDecl)
+			// xmlspec:XMLDecl, the value of the token is the encoding
+			var encoding RawString
+			order := []NameString{"version", "encoding", "standalone"}
+			for tt.skipWhite(); !tt.skipStr("?>"); tt.skipWhite() {
+				n, v, ec := tt.readAttrPair()
+				if ec != ErrCodeOk {
+					return mkerr(ec)
+				}
+				for len(order) > 0 && order[0] != n {
+					order = order[1:]
+				}
+				if len(order) == 0 {
+					return mkerr(ErrCodeInvalidXmlDecl)
+				}
+				order = order[1:]
+				if n == "encoding" {
+					encoding = v
+				}
 			}
 			tt.state = stateProlog
-			return mktoken(XmlDecl, "", v)
+			return mktoken(XmlDecl, "", encoding)
 		}
 		tt.state = stateProlog
 	}
@@ -0,0 +1,223 @@
+package xg
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// fieldFlags describe how a struct field maps to XML
+type fieldFlags int
+
+const (
+	fElement = fieldFlags(1 << iota)
+	fAttr
+	fCharData
+	fInnerXML
+	fComment
+	fAny
+	fOmitEmpty
+	fCData // character data written as a CDATA section
+
+	fMode = fElement | fAttr | fCharData | fInnerXML | fComment | fAny
+)
+
+// fieldInfo is the XML mapping of a struct field
+type fieldInfo struct {
+	idx     []int // index sequence for reflect.Value.FieldByIndex
+	name    string
+	parents []string // enclosing elements of a>b>name fields
+	flags   fieldFlags
+	typ     reflect.Type
+}
+
+// typeInfo is the cached XML mapping of a struct type
+type typeInfo struct {
+	xmlname *fieldInfo // XMLName field, its tag holds the element name
+	fields  []fieldInfo
+}
+
+var tinfoMap sync.Map // map[reflect.Type]*typeInfo
+
+// getTypeInfo returns the XML mapping of the struct type, parsing the field
+// tags once per type
+func getTypeInfo(typ reflect.Type) (*typeInfo, error) {
+	if ti, ok := tinfoMap.Load(typ); ok {
+		return ti.(*typeInfo), nil
+	}
+	ti := &typeInfo{}
+	if err := ti.addFields(typ, nil); err != nil {
+		return nil, err
+	}
+	if err := ti.resolveConflicts(typ); err != nil {
+		return nil, err
+	}
+	v, _ := tinfoMap.LoadOrStore(typ, ti)
+	return v.(*typeInfo), nil
+}
+
+func (ti *typeInfo) addFields(typ reflect.Type, parent []int) error {
+	for i, n := 0, typ.NumField(); i < n; i++ {
+		f := typ.Field(i)
+		tag, tagged := f.Tag.Lookup("xg")
+		if !tagged {
+			// encoding/xml compatibility
+			tag, tagged = f.Tag.Lookup("xml")
+		}
+		if tag == "-" {
+			continue
+		}
+		idx := append(append([]int{}, parent...), i)
+
+		if f.Name == "XMLName" {
+			if ti.xmlname == nil || len(idx) < len(ti.xmlname.idx) {
+				name := strings.Split(tag, ",")[0]
+				ti.xmlname = &fieldInfo{idx: idx, name: name[strings.LastIndexByte(name, ' ')+1:]}
+			}
+			continue
+		}
+
+		if f.Anonymous && !tagged {
+			t := f.Type
+			if t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+			if t.Kind() == reflect.Struct {
+				if err := ti.addFields(t, idx); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		finfo, err := parseFieldTag(f, tag)
+		if err != nil {
+			return err
+		}
+		finfo.idx = idx
+		finfo.typ = f.Type
+		ti.fields = append(ti.fields, finfo)
+	}
+	return nil
+}
+
+// parseFieldTag parses tags of the form "name,flag,flag". The name may be
+// qualified with enclosing elements as in "a>b>name", a namespace URI
+// separated with a space is ignored.
+func parseFieldTag(f reflect.StructField, tag string) (fieldInfo, error) {
+	finfo := fieldInfo{}
+	tokens := strings.Split(tag, ",")
+	finfo.name = tokens[0]
+	if i := strings.LastIndexByte(finfo.name, ' '); i >= 0 {
+		finfo.name = finfo.name[i+1:]
+	}
+	if strings.Contains(finfo.name, ">") {
+		path := strings.Split(finfo.name, ">")
+		for _, p := range path {
+			if p == "" {
+				return finfo, fmt.Errorf("xg: invalid tag %q on field %s: empty element name", tag, f.Name)
+			}
+		}
+		finfo.parents, finfo.name = path[:len(path)-1], path[len(path)-1]
+	}
+	for _, flag := range tokens[1:] {
+		switch flag {
+		case "attr":
+			finfo.flags |= fAttr
+		case "chardata":
+			finfo.flags |= fCharData
+		case "cdata":
+			finfo.flags |= fCharData | fCData
+		case "innerxml":
+			finfo.flags |= fInnerXML
+		case "comment":
+			finfo.flags |= fComment
+		case "any":
+			finfo.flags |= fAny
+		case "omitempty":
+			finfo.flags |= fOmitEmpty
+		default:
+			return finfo, fmt.Errorf("xg: invalid tag %q on field %s: unknown flag '%s'", tag, f.Name, flag)
+		}
+	}
+	switch mode := finfo.flags & fMode; mode {
+	case 0:
+		finfo.flags |= fElement
+	case fAttr, fAny:
+		if finfo.parents != nil {
+			return finfo, fmt.Errorf("xg: invalid tag %q on field %s: a>b is only allowed on elements", tag, f.Name)
+		}
+	case fCharData, fInnerXML, fComment:
+		if finfo.name != "" {
+			return finfo, fmt.Errorf("xg: invalid tag %q on field %s: name is not allowed", tag, f.Name)
+		}
+	default:
+		return finfo, fmt.Errorf("xg: invalid tag %q on field %s: conflicting flags", tag, f.Name)
+	}
+	if finfo.name == "" && finfo.flags&(fElement|fAttr|fAny) != 0 {
+		finfo.name = f.Name
+	}
+	return finfo, nil
+}
+
+// resolveConflicts drops fields hidden by shallower fields with the same name,
+// similar to the visibility rules of embedded Go fields
+func (ti *typeInfo) resolveConflicts(typ reflect.Type) error {
+	key := func(f *fieldInfo) string {
+		switch f.flags & fMode {
+		case fElement:
+			return "e:" + strings.Join(append(f.parents[:len(f.parents):len(f.parents)], f.name), ">")
+		case fAttr:
+			return "a:" + f.name
+		}
+		return fmt.Sprint(f.flags & fMode)
+	}
+	best := map[string]int{}
+	for i := range ti.fields {
+		f := &ti.fields[i]
+		k := key(f)
+		j, ok := best[k]
+		if !ok {
+			best[k] = i
+			continue
+		}
+		g := &ti.fields[j]
+		if len(f.idx) == len(g.idx) {
+			return fmt.Errorf("xg: %s has conflicting fields for %q", typ, f.name)
+		}
+		if len(f.idx) < len(g.idx) {
+			best[k] = i
+		}
+	}
+	kept := ti.fields[:0]
+	for i := range ti.fields {
+		if best[key(&ti.fields[i])] == i {
+			kept = append(kept, ti.fields[i])
+		}
+	}
+	ti.fields = kept
+	return nil
+}
+
+// fieldByIndex returns the field, allocating nil embedded pointers when
+// alloc is set. Without alloc, it returns an invalid value if the field is
+// behind a nil pointer.
+func fieldByIndex(v reflect.Value, idx []int, alloc bool) reflect.Value {
+	for i, x := range idx {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
@@ -0,0 +1,94 @@
+package xg
+
+import "reflect"
+
+// Element writes an element, fn writes its attributes and content. The tag is
+// closed even when fn fails. Element returns the error of fn, or the first
+// error of w, see Err.
+func (w *Writer) Element(name string, fn func() error) error {
+	w.OTag(name)
+	defer w.CTag()
+	if fn != nil {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return w.err
+}
+
+// Elem is an element built with El. Writing an element does not modify it,
+// elements can be shared and reused as templates.
+type Elem struct {
+	Name  string
+	Items []Marshaler // attributes, text and child elements
+}
+
+// El builds an element from attributes (A), text (Text), child elements and
+// other Marshaler values. Attributes are written first, in order, followed
+// by the content items. Nil items are skipped.
+func El(name string, items ...Marshaler) *Elem {
+	return &Elem{Name: name, Items: items}
+}
+
+// With returns a copy of the element with additional items
+func (e *Elem) With(items ...Marshaler) *Elem {
+	all := make([]Marshaler, 0, len(e.Items)+len(items))
+	all = append(all, e.Items...)
+	return &Elem{Name: e.Name, Items: append(all, items...)}
+}
+
+// MarshalXG writes the element with its attributes and content, a nil
+// element writes nothing
+func (e *Elem) MarshalXG(w *Writer) error {
+	if e == nil {
+		return nil
+	}
+	return w.Element(e.Name, func() error {
+		for _, it := range e.Items {
+			if a, ok := it.(AttrItem); ok {
+				w.StringAttr(a.Name, a.Value)
+			}
+		}
+		for _, it := range e.Items {
+			if _, ok := it.(AttrItem); ok || it == nil || isNilValue(reflect.ValueOf(it)) {
+				continue
+			}
+			w.BeginContent()
+			if err := it.MarshalXG(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AttrItem is an attribute built with A
+type AttrItem struct {
+	Name  string
+	Value string
+}
+
+// A builds an attribute for El
+func A(name, value string) AttrItem {
+	return AttrItem{Name: name, Value: value}
+}
+
+// MarshalXG writes the attribute to the open tag
+func (a AttrItem) MarshalXG(w *Writer) error {
+	w.StringAttr(a.Name, a.Value)
+	return nil
+}
+
+// TextItem is character data built with Text
+type TextItem string
+
+// Text builds character data for El
+func Text(s string) TextItem {
+	return TextItem(s)
+}
+
+// MarshalXG writes the escaped text
+func (t TextItem) MarshalXG(w *Writer) error {
+	w.String(string(t))
+	return nil
+}
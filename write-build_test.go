@@ -0,0 +1,71 @@
+package xg
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestElement(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := NewWriter(out)
+	errFail := errors.New("fail")
+	err := w.Element("a", func() error {
+		w.StringAttr("x", "1")
+		w.Element("b", func() error {
+			w.String("text")
+			return nil
+		})
+		return w.Element("c", func() error { return errFail })
+	})
+	if err != errFail || w.Err() != nil {
+		t.Errorf("got %v", err)
+	}
+	if got, want := out.String(), `<a x="1"><b>text</b><c /></a>`; got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	link := El("a", A("class", "link"))
+	page := El("html",
+		El("body", A("id", "main"),
+			link.With(A("href", "/x?a&b"), Text("x < y")),
+			nil,
+			(*Elem)(nil),
+			Text(" & "),
+			link.With(Text("empty")),
+			El("p", Text("a"), A("lang", "en"), El("br")),
+		),
+	)
+	want := `<html><body id="main"><a class="link" href="/x?a&amp;b">x &lt; y</a> &amp; ` +
+		`<a class="link">empty</a><p lang="en">a<br /></p></body></html>`
+	for i := 0; i < 2; i++ {
+		out := &bytes.Buffer{}
+		w := NewWriter(out)
+		w.Write(page)
+		if err := w.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if got := out.String(); got != want {
+			t.Errorf("got  %s\nwant %s", got, want)
+		}
+	}
+	if len(link.Items) != 1 {
+		t.Errorf("template modified: %+v", link.Items)
+	}
+
+	// builder values mix with struct fields and other marshalers
+	out := &bytes.Buffer{}
+	w := NewWriter(out)
+	w.OTag("doc")
+	w.Write(struct {
+		Body *Elem `xg:"body"`
+	}{El("b", Text("1"))})
+	w.Write(El("c", NewText("2")))
+	(*Elem)(nil).MarshalXG(w)
+	w.CTag()
+	if got, want := out.String(), `<doc><body><b>1</b></body><c>2</c></doc>`; got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
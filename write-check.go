@@ -0,0 +1,56 @@
+package xg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// misuse panics, or records the error in checking mode
+func (w *Writer) misuse(msg string) {
+	if !w.opts.Check {
+		panic(msg)
+	}
+	w.fail(errors.New(msg))
+}
+
+// checkTag verifies the name of a new element
+func (w *Writer) checkTag(name string) {
+	w.attrNames = w.attrNames[:0]
+	if !isName(name) {
+		w.fail(fmt.Errorf("xml writer: invalid element name %q", name))
+	} else if w.roots > 1 {
+		w.fail(fmt.Errorf("xml writer: second root element <%s>", name))
+	}
+}
+
+// checkAttr verifies the name of an attribute of the open tag
+func (w *Writer) checkAttr(name string) {
+	if !isName(name) {
+		w.fail(fmt.Errorf("xml writer: invalid attribute name %q", name))
+		return
+	}
+	for _, n := range w.attrNames {
+		if n == name {
+			w.fail(fmt.Errorf("xml writer: duplicate attribute %q on <%s>", name, strings.TrimPrefix(w.names[len(w.names)-1], "+")))
+			return
+		}
+	}
+	w.attrNames = append(w.attrNames, name)
+}
+
+// Close flushes the output, including output held back in auto-indent mode,
+// it does not close the underlying writer. In checking mode, it verifies that
+// the document has a root element and that all tags are closed. Close
+// returns the first error, see Err.
+func (w *Writer) Close() error {
+	w.release()
+	if w.opts.Check {
+		if len(w.names) > 0 {
+			w.fail(fmt.Errorf("xml writer: unclosed tag <%s>", strings.TrimPrefix(w.names[len(w.names)-1], "+")))
+		} else if w.roots == 0 {
+			w.fail(errors.New("xml writer: missing root element"))
+		}
+	}
+	return w.Flush()
+}
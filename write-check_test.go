@@ -0,0 +1,48 @@
+package xg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriterCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(w *Writer)
+		err   string
+	}{
+		{"ok", func(w *Writer) {
+			w.XmlDecl()
+			w.Comment("c")
+			w.OTag("+a")
+			w.StringAttr("x", "1")
+			w.AttrNS("urn:y", "x", "2")
+			w.OTag("b")
+			w.StringAttr("x", "1")
+			w.CTag()
+			w.CTag()
+			w.String("\n")
+		}, ""},
+		{"element name", func(w *Writer) { w.OTag("1a") }, `xml writer: invalid element name "1a"`},
+		{"attribute name", func(w *Writer) { w.OTag("a"); w.StringAttr("a b", "") }, `xml writer: invalid attribute name "a b"`},
+		{"duplicate", func(w *Writer) { w.OTag("a"); w.Attr("x", 1); w.OptStringAttr("x", "2") }, `xml writer: duplicate attribute "x" on <a>`},
+		{"second root", func(w *Writer) { w.OTag("a"); w.CTag(); w.OTag("b"); w.CTag() }, "xml writer: second root element <b>"},
+		{"text", func(w *Writer) { w.OTag("a"); w.CTag(); w.String("x") }, "xml writer: text outside of the root element"},
+		{"unclosed", func(w *Writer) { w.OTag("a"); w.OTag("+b") }, "xml writer: unclosed tag <b>"},
+		{"missing root", func(w *Writer) { w.Comment("x") }, "xml writer: missing root element"},
+		{"underflow", func(w *Writer) { w.OTag("a"); w.CTag(); w.CTag() }, "xml writer: tag stack underflow"},
+		{"attribute", func(w *Writer) { w.OTag("a"); w.String("x"); w.StringAttr("y", "") }, "xml writer: trying to write an attribute outside of an open tag"},
+		{"decl", func(w *Writer) { w.OTag("a"); w.CTag(); w.XmlDecl() }, "xml writer: invalid XmlDecl placement"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWriter(&bytes.Buffer{})
+			w.SetOptions(WriterOptions{Check: true})
+			tt.write(w)
+			err := w.Close()
+			if (err == nil && tt.err != "") || (err != nil && err.Error() != tt.err) {
+				t.Errorf("got %v\nwant %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package xg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CData writes s as a CDATA section, occurrences of ]]> are split between
+// two sections
+func (w *Writer) CData(s string) {
+	w.BeginContent()
+	w.text(s)
+	w.put("<![CDATA[")
+	w.put(strings.ReplaceAll(w.validChars(s), "]]>", "]]]]><![CDATA[>"))
+	w.put("]]>")
+}
+
+// PI writes a processing instruction. A target that is not a name, a target
+// reserved by XML, and data that contains ?> are recorded as errors, see Err.
+func (w *Writer) PI(target string, data string) {
+	switch {
+	case !isName(target):
+		w.fail(fmt.Errorf("xml writer: invalid processing instruction target %q", target))
+	case strings.EqualFold(target, "xml"):
+		w.fail(fmt.Errorf("xml writer: processing instruction target %q is reserved", target))
+	case strings.Contains(data, "?>"):
+		w.fail(fmt.Errorf("xml writer: processing instruction data contains \"?>\""))
+	}
+	w.beginMarkup()
+	w.put("<?")
+	w.put(target)
+	if data != "" {
+		w.put(" ")
+		w.put(w.validChars(data))
+	}
+	w.put("?>")
+}
+
+// DocType writes a document type declaration before the root element.
+// Without systemID, publicID must be empty as well. The internal subset is
+// written as is.
+func (w *Writer) DocType(name, publicID, systemID, internalSubset string) {
+	if len(w.names) > 0 || (w.opts.Check && w.roots > 0) {
+		w.misuse("xml writer: invalid DocType placement")
+		return
+	}
+	if !isName(name) {
+		w.fail(fmt.Errorf("xml writer: invalid document type name %q", name))
+	} else if publicID != "" && systemID == "" {
+		w.fail(fmt.Errorf("xml writer: document type %s has a public ID without a system ID", name))
+	}
+	w.beginMarkup()
+	w.put("<!DOCTYPE ")
+	w.put(name)
+	if publicID != "" {
+		w.put(" PUBLIC ")
+		w.putLiteral(publicID)
+	} else if systemID != "" {
+		w.put(" SYSTEM")
+	}
+	if systemID != "" {
+		w.put(" ")
+		w.putLiteral(systemID)
+	}
+	if internalSubset != "" {
+		w.put(" [")
+		w.put(internalSubset)
+		w.put("]")
+	}
+	w.put(">")
+}
+
+// putLiteral writes a quoted literal, literals cannot contain both kinds of
+// quotes
+func (w *Writer) putLiteral(s string) {
+	q := `"`
+	if strings.Contains(s, q) {
+		q = "'"
+		if strings.Contains(s, q) {
+			w.fail(fmt.Errorf("xml writer: literal %q contains both kinds of quotes", s))
+		}
+	}
+	w.put(q)
+	w.put(s)
+	w.put(q)
+}
+
+// Raw writes markup as is, without any checks. Raw markup is treated as text
+// in auto-indent mode.
+func (w *Writer) Raw(s string) {
+	if s == "" {
+		return
+	}
+	w.BeginContent()
+	w.text(s)
+	w.put(s)
+}
+
+// RawChecked writes markup as is when it is a well-formed fragment of
+// element content, otherwise nothing is written and the error is returned and
+// recorded, see Err
+func (w *Writer) RawChecked(s string) error {
+	if err := CheckFragment(s); err != nil {
+		w.fail(err)
+		return err
+	}
+	w.Raw(s)
+	return w.err
+}
+
+// fragmentEnd closes the fragment checked by CheckFragment
+const fragmentEnd = "</xg:fragment>"
+
+// CheckFragment checks that s is well-formed element content: tags are
+// balanced and properly nested, attribute names are unique, character data
+// does not contain ]]>, and & starts a predefined entity reference or a
+// reference to a character allowed by XML 1.0
+func CheckFragment(s string) error {
+	tt := &tokenizer{buf: s + fragmentEnd, state: stateContent, stack: []NameString{"xg:fragment"}}
+	var attrs []NameString // attributes of the current tag
+	for {
+		t := tt.Next()
+		if t.SrcPos >= len(s) && t.Kind != EOF {
+			if t.Kind == EndContent && len(tt.stack) == 0 && tt.cur == len(tt.buf) {
+				return nil
+			}
+			return NewError(ErrCodeUnexpectedEOF, s, len(s))
+		}
+		switch t.Kind {
+		case Err:
+			return t.Error
+		case Tag:
+			attrs = attrs[:0]
+		case Attrib:
+			for _, a := range attrs {
+				if a == t.Name {
+					return NewError(ErrDuplicateAttribute, s, t.SrcPos)
+				}
+			}
+			attrs = append(attrs, t.Name)
+			if i := badReference(t.Raw); i >= 0 {
+				return NewError(ErrInvalidReference, s, t.SrcPos+i)
+			}
+		case SData:
+			if i := strings.Index(t.Raw, "]]>"); i >= 0 {
+				return NewError(ErrCDataEndInText, s, t.SrcPos+i)
+			}
+			if i := badReference(t.Raw); i >= 0 {
+				return NewError(ErrInvalidReference, s, t.SrcPos+i)
+			}
+		case EOF:
+			return NewError(ErrCodeUnexpectedContent, s, len(s))
+		}
+	}
+}
+
+// badReference returns the offset of the first & that does not start a
+// predefined entity reference or a reference to a character allowed by
+// XML 1.0, or -1
+func badReference(s string) int {
+	for o := 0; ; {
+		i := strings.IndexByte(s[o:], '&')
+		if i < 0 {
+			return -1
+		}
+		o += i + 1
+		if cp, n := extractcp(s[o:]); n == 0 || !isRefChar(cp) {
+			return o - 1
+		}
+	}
+}
+
+// isRefChar reports whether a character reference to cp is allowed by XML 1.0
+func isRefChar(cp rune) bool {
+	if cp < ' ' {
+		return cp == '\t' || cp == '\n' || cp == '\r'
+	}
+	return !(cp >= 0xd800 && cp < 0xe000) && isChar(cp, 0)
+}
+
+// isName reports whether s is an XML name, as far as the tokenizer checks
+func isName(s string) bool {
+	if s == "" || !isNameStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isNameChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package xg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriterMarkup(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := NewWriter(out)
+	w.DocType("html", "-//W3C//DTD XHTML 1.0 Strict//EN", "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd", "")
+	w.DocType("a", "", `say "hi"`, `<!ENTITY e "x">`)
+	w.OTag("a")
+	w.PI("target", "data")
+	w.CData("x]]>y")
+	w.Raw("<b>&amp;</b>")
+	if err := w.RawChecked(`<c x="1"><d/>text</c>`); err != nil {
+		t.Fatal(err)
+	}
+	w.CTag()
+	want := `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd">` +
+		`<!DOCTYPE a SYSTEM 'say "hi"' [<!ENTITY e "x">]>` +
+		`<a><?target data?><![CDATA[x]]]]><![CDATA[>y]]><b>&amp;</b><c x="1"><d/>text</c></a>`
+	if got := out.String(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	if err := w.Err(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWriterMarkupErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(w *Writer)
+		err   string
+	}{
+		{"pi data", func(w *Writer) { w.PI("t", "a?>b") }, `xml writer: processing instruction data contains "?>"`},
+		{"pi target", func(w *Writer) { w.PI("1t", "") }, `xml writer: invalid processing instruction target "1t"`},
+		{"pi reserved", func(w *Writer) { w.PI("XML", "") }, `xml writer: processing instruction target "XML" is reserved`},
+		{"doctype name", func(w *Writer) { w.DocType("", "", "", "") }, `xml writer: invalid document type name ""`},
+		{"doctype public", func(w *Writer) { w.DocType("a", "p", "", "") }, "xml writer: document type a has a public ID without a system ID"},
+		{"doctype quotes", func(w *Writer) { w.DocType("a", "", `'"`, "") }, `xml writer: literal "'\"" contains both kinds of quotes`},
+		{"raw open", func(w *Writer) { w.RawChecked("<a><b></b>") }, "xml parser [1:11]: unexpected end of file"},
+		{"raw mismatch", func(w *Writer) { w.RawChecked("<a></b>") }, "xml parser [1:4]: mismatching tag"},
+		{"raw close", func(w *Writer) { w.RawChecked("x</a>") }, "xml parser [1:2]: mismatching tag"},
+		{"raw amp", func(w *Writer) { w.RawChecked("a\n b & c") }, "xml parser [2:4]: invalid reference"},
+		{"raw attr", func(w *Writer) { w.RawChecked(`<a x="&y;"/>`) }, "xml parser [1:7]: invalid reference"},
+		{"raw cdata end", func(w *Writer) { w.RawChecked("x]]>y") }, "xml parser [1:2]: ]]> in character data"},
+		{"raw duplicate", func(w *Writer) { w.RawChecked("<b x='1' x='2'/>") }, "xml parser [1:10]: duplicate attribute"},
+		{"raw char ref", func(w *Writer) { w.RawChecked("a&#0;") }, "xml parser [1:2]: invalid reference"},
+		{"raw surrogate", func(w *Writer) { w.RawChecked("<a x='&#xD800;'/>") }, "xml parser [1:7]: invalid reference"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			w := NewWriter(out)
+			tt.write(w)
+			if err := w.Err(); err == nil || err.Error() != tt.err {
+				t.Errorf("got %v\nwant %s", err, tt.err)
+			}
+		})
+	}
+}
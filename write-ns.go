@@ -0,0 +1,169 @@
+package xg
+
+import (
+	"strconv"
+	"strings"
+)
+
+// nsBinding is a namespace declaration in scope
+type nsBinding struct {
+	prefix string // empty for the default namespace
+	uri    string
+	depth  int // number of open elements, including the declaring element
+}
+
+// SetPrefix sets the preferred prefix of a namespace for OTagNS and AttrNS,
+// an empty prefix makes elements of the namespace use the default namespace
+func (w *Writer) SetPrefix(uri, prefix string) {
+	if w.prefixes == nil {
+		w.prefixes = map[string]string{}
+	}
+	w.prefixes[uri] = prefix
+}
+
+// bind records a namespace declaration of the current open tag, also when
+// written with StringAttr
+func (w *Writer) bind(prefix, uri string) {
+	w.bindings = append(w.bindings, nsBinding{prefix: prefix, uri: uri, depth: len(w.names)})
+}
+
+// popBindings removes the declarations of a closed element
+func (w *Writer) popBindings() {
+	n := len(w.bindings)
+	for n > 0 && w.bindings[n-1].depth > len(w.names) {
+		n--
+	}
+	w.bindings = w.bindings[:n]
+}
+
+// LookupPrefix returns the namespace URI bound to the prefix in the current
+// scope, an empty prefix looks up the default namespace
+func (w *Writer) LookupPrefix(prefix string) (uri string, ok bool) {
+	if prefix == "xml" {
+		return xmlNamespaceURI, true
+	}
+	for i := len(w.bindings) - 1; i >= 0; i-- {
+		if b := w.bindings[i]; b.prefix == prefix {
+			return b.uri, b.uri != "" || prefix == ""
+		}
+	}
+	return "", prefix == ""
+}
+
+// prefixOf returns a prefix bound to uri in the current scope, attributes
+// need a non-empty prefix
+func (w *Writer) prefixOf(uri string, attr bool) (string, bool) {
+	if uri == xmlNamespaceURI {
+		return "xml", true
+	}
+	if uri == "" {
+		def, _ := w.LookupPrefix("")
+		return "", !attr && def == ""
+	}
+	for i := len(w.bindings) - 1; i >= 0; i-- {
+		b := w.bindings[i]
+		if b.uri != uri || (attr && b.prefix == "") {
+			continue
+		}
+		if u, _ := w.LookupPrefix(b.prefix); u == uri {
+			return b.prefix, true
+		}
+	}
+	return "", false
+}
+
+// newPrefix returns the prefix for declaring uri, the prefix set with
+// SetPrefix or a generated one. Attributes are declared on the open tag and
+// need a non-empty prefix that is not bound to another namespace in scope,
+// redeclaring it would move the tag or its attributes to uri.
+func (w *Writer) newPrefix(uri string, attr bool) string {
+	prefix, ok := w.prefixes[uri]
+	if ok && prefix != "xml" && prefix != "xmlns" && !(attr && !w.attrPrefixFree(prefix, uri)) {
+		return prefix
+	}
+	for {
+		w.nsCount++
+		prefix = "ns" + strconv.Itoa(w.nsCount)
+		if _, used := w.LookupPrefix(prefix); !used {
+			return prefix
+		}
+	}
+}
+
+// declare writes the namespace declaration of the prefix
+func (w *Writer) declare(prefix, uri string) {
+	if prefix == "" {
+		w.StringAttr("xmlns", uri)
+	} else {
+		w.StringAttr("xmlns:"+prefix, uri)
+	}
+}
+
+// attrPrefixFree reports whether an attribute of uri can declare the prefix
+// on the open tag
+func (w *Writer) attrPrefixFree(prefix, uri string) bool {
+	if prefix == "" || w.boundHere(prefix) {
+		return false
+	}
+	tag := strings.TrimPrefix(w.names[len(w.names)-1], "+")
+	if i := strings.IndexByte(tag, ':'); i >= 0 && tag[:i] == prefix {
+		return false
+	}
+	bound, ok := w.LookupPrefix(prefix)
+	return !ok || bound == uri
+}
+
+// boundHere reports whether the open tag already declares the prefix
+func (w *Writer) boundHere(prefix string) bool {
+	for i := len(w.bindings) - 1; i >= 0 && w.bindings[i].depth == len(w.names); i-- {
+		if w.bindings[i].prefix == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// OTagNS opens an element of the namespace, an empty uri stands for no
+// namespace. Prefixes bound in the current scope are reused, otherwise the
+// namespace is declared on the element. A + prefix of local requests
+// indentation as with OTag.
+func (w *Writer) OTagNS(uri, local string) {
+	indent := ""
+	if strings.HasPrefix(local, "+") {
+		indent, local = "+", local[1:]
+	}
+	prefix, bound := w.prefixOf(uri, false)
+	if p, ok := w.prefixes[uri]; bound && ok && p == "" && prefix != "" {
+		bound = false // declare the default namespace instead
+	}
+	if !bound && uri != "" {
+		prefix = w.newPrefix(uri, false)
+	}
+	if prefix != "" {
+		w.OTag(indent + prefix + ":" + local)
+	} else {
+		w.OTag(indent + local)
+	}
+	if !bound {
+		w.declare(prefix, uri)
+	}
+}
+
+// AttrNS writes an attribute of the namespace, declaring a prefix when none
+// is bound in the current scope
+func (w *Writer) AttrNS(uri, local, value string) {
+	if !w.inOtag {
+		w.misuse("xml writer: trying to write an attribute outside of an open tag")
+		return
+	}
+	if uri == "" {
+		w.StringAttr(local, value)
+		return
+	}
+	prefix, ok := w.prefixOf(uri, true)
+	if !ok {
+		prefix = w.newPrefix(uri, true)
+		w.declare(prefix, uri)
+	}
+	w.StringAttr(prefix+":"+local, value)
+}
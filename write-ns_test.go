@@ -0,0 +1,89 @@
+package xg
+
+import (
+	"bytes"
+	"testing"
+)
+
+const (
+	soapNS = "http://schemas.xmlsoap.org/soap/envelope/"
+	atomNS = "http://www.w3.org/2005/Atom"
+)
+
+func TestWriterNamespaces(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(w *Writer)
+		want  string
+	}{
+		{"preferred", func(w *Writer) {
+			w.SetPrefix(soapNS, "soap")
+			w.OTagNS(soapNS, "Envelope")
+			w.OTagNS(soapNS, "Body")
+			w.OTagNS("urn:m", "Get")
+			w.AttrNS(soapNS, "mustUnderstand", "1")
+			w.CTag()
+			w.OTagNS("urn:m", "Get")
+			w.CTag()
+			w.CTag()
+			w.CTag()
+		}, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<ns1:Get xmlns:ns1="urn:m" soap:mustUnderstand="1" /><ns2:Get xmlns:ns2="urn:m" /></soap:Body></soap:Envelope>`},
+		{"default", func(w *Writer) {
+			w.SetPrefix(atomNS, "")
+			w.OTagNS(atomNS, "feed")
+			w.AttrNS(xmlNamespaceURI, "lang", "en")
+			w.OTagNS(atomNS, "title")
+			w.AttrNS(atomNS, "type", "text")
+			w.CTag()
+			w.OTagNS("", "plain")
+			w.OTagNS("", "inner")
+			w.CTag()
+			w.CTag()
+			w.CTag()
+		}, `<feed xmlns="http://www.w3.org/2005/Atom" xml:lang="en"><title xmlns:ns1="http://www.w3.org/2005/Atom" ns1:type="text" />` +
+			`<plain xmlns=""><inner /></plain></feed>`},
+		{"manual", func(w *Writer) {
+			w.OTag("a")
+			w.StringAttr("xmlns:x", "urn:x")
+			w.OTagNS("urn:x", "b")
+			w.StringAttr("xmlns:x", "urn:y")
+			w.OTagNS("urn:x", "c")
+			w.CTag()
+			w.CTag()
+			w.OTagNS("urn:x", "d")
+			w.AttrNS("urn:x", "e", "1")
+			w.CTag()
+			w.CTag()
+		}, `<a xmlns:x="urn:x"><x:b xmlns:x="urn:y"><ns1:c xmlns:ns1="urn:x" /></x:b><x:d x:e="1" /></a>`},
+		{"conflict", func(w *Writer) {
+			w.SetPrefix("urn:a", "p")
+			w.SetPrefix("urn:b", "p")
+			w.OTagNS("urn:a", "x")
+			w.AttrNS("urn:b", "y", "1")
+			w.CTag()
+		}, `<p:x xmlns:p="urn:a" xmlns:ns1="urn:b" ns1:y="1" />`},
+		{"shadowed", func(w *Writer) {
+			w.SetPrefix("urn:a", "a")
+			w.SetPrefix("urn:b", "a")
+			w.OTagNS("urn:a", "root")
+			w.OTagNS("urn:a", "child")
+			w.AttrNS("urn:b", "z", "1")
+			w.CTag()
+			w.CTag()
+		}, `<a:root xmlns:a="urn:a"><a:child xmlns:ns1="urn:b" ns1:z="1" /></a:root>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			w := NewWriter(out)
+			tt.write(w)
+			if got := out.String(); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+			if _, err := ParseDocument(out.String()); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
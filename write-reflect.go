@@ -2,12 +2,14 @@ package xg
 
 import (
 	"encoding"
+	"encoding/xml"
 	"reflect"
 	"strconv"
 )
 
 var (
 	marshalerType     = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	attrMarshalerType = reflect.TypeOf((*AttrMarshaler)(nil)).Elem()
 	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
 )
 
@@ -15,6 +17,14 @@ type Marshaler interface {
 	MarshalXG(w *Writer) error
 }
 
+// AttrMarshaler is implemented by types that write themselves as attributes.
+// The name is the attribute name the value is written under. An
+// implementation may write a single attribute with w.StringAttr, several
+// attributes, or nothing to omit the attribute.
+type AttrMarshaler interface {
+	MarshalXGAttr(name string, w *Writer) error
+}
+
 func toStr(v interface{}) (string, error) {
 	return marshalToStr(reflect.ValueOf(v))
 }
@@ -34,19 +44,6 @@ func marshalToStr(val reflect.Value) (string, error) {
 	kind := val.Kind()
 	typ := val.Type()
 
-	/*
-
-		if val.CanInterface() && typ.Implements(marshalerType) {
-			return w.handleMarshaler(val.Interface().(Marshaler))
-		}
-		if val.CanAddr() {
-			pv := val.Addr()
-			if pv.CanInterface() && pv.Type().Implements(marshalerType) {
-				return w.handleMarshaler(pv.Interface().(Marshaler))
-			}
-		}
-	*/
-
 	if val.CanInterface() && typ.Implements(textMarshalerType) {
 		return marshalTextMarshalerToStr(val.Interface().(encoding.TextMarshaler))
 	}
@@ -71,8 +68,26 @@ func marshalToStr(val reflect.Value) (string, error) {
 	}
 
 	if kind == reflect.Struct {
-		// not supported yet
-		return "", nil
+		// a struct converts to its character data
+		ti, err := getTypeInfo(typ)
+		if err != nil {
+			return "", err
+		}
+		ss := ""
+		for i := range ti.fields {
+			f := &ti.fields[i]
+			if f.flags&fCharData == 0 {
+				continue
+			}
+			if fv := fieldByIndex(val, f.idx, false); fv.IsValid() {
+				s, err := marshalToStr(fv)
+				if err != nil {
+					return "", err
+				}
+				ss += s
+			}
+		}
+		return ss, nil
 	}
 
 	s, err := marshalSimple(typ, val)
@@ -85,11 +100,13 @@ func toContent(w *Writer, v interface{}) error {
 
 func marshalToContent(w *Writer, val reflect.Value) error {
 	if !val.IsValid() {
+		w.BeginContent()
 		return nil
 	}
 
 	for val.Kind() == reflect.Interface || val.Kind() == reflect.Ptr {
 		if val.IsNil() {
+			w.BeginContent()
 			return nil
 		}
 		val = val.Elem()
@@ -100,12 +117,14 @@ func marshalToContent(w *Writer, val reflect.Value) error {
 
 	if val.CanInterface() && typ.Implements(marshalerType) {
 		v := val.Interface().(Marshaler)
+		w.BeginContent()
 		return v.MarshalXG(w)
 	}
 	if val.CanAddr() {
 		pv := val.Addr()
 		if pv.CanInterface() && pv.Type().Implements(marshalerType) {
 			v := pv.Interface().(Marshaler)
+			w.BeginContent()
 			return v.MarshalXG(w)
 		}
 	}
@@ -115,6 +134,7 @@ func marshalToContent(w *Writer, val reflect.Value) error {
 		if err != nil {
 			return err
 		}
+		w.BeginContent()
 		w.scramblestr(s)
 		return nil
 	}
@@ -125,12 +145,14 @@ func marshalToContent(w *Writer, val reflect.Value) error {
 			if err != nil {
 				return err
 			}
+			w.BeginContent()
 			w.scramblestr(s)
 			return nil
 		}
 	}
 
 	if (kind == reflect.Slice || kind == reflect.Array) && typ.Elem().Kind() != reflect.Uint8 {
+		w.BeginContent()
 		for i, n := 0, val.Len(); i < n; i++ {
 			if err := marshalToContent(w, val.Index(i)); err != nil {
 				return err
@@ -140,18 +162,261 @@ func marshalToContent(w *Writer, val reflect.Value) error {
 	}
 
 	if kind == reflect.Struct {
-		// not supported yet
-		return nil
+		return marshalStruct(w, val)
 	}
 
 	s, err := marshalSimple(typ, val)
 	if err != nil {
 		return err
 	}
+	w.BeginContent()
 	w.scramblestr(s)
 	return nil
 }
 
+// marshalStruct writes attribute fields while the tag is still open, then
+// the content fields in declaration order
+func marshalStruct(w *Writer, val reflect.Value) error {
+	ti, err := getTypeInfo(val.Type())
+	if err != nil {
+		return err
+	}
+	if w.inOtag {
+		for i := range ti.fields {
+			f := &ti.fields[i]
+			if f.flags&fAttr == 0 {
+				continue
+			}
+			fv := fieldByIndex(val, f.idx, false)
+			if !fv.IsValid() || isNilValue(fv) || (f.flags&fOmitEmpty != 0 && isEmptyValue(fv)) {
+				continue
+			}
+			if err := marshalAttr(w, f.name, fv, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the tag stays open for structs without content, so that an empty
+	// element tag can be written
+
+	var parents []string // open enclosing elements of a>b fields
+	setParents := func(names []string) {
+		n := 0
+		for n < len(parents) && n < len(names) && parents[n] == names[n] {
+			n++
+		}
+		for len(parents) > n {
+			w.CTag()
+			parents = parents[:len(parents)-1]
+		}
+		for _, name := range names[n:] {
+			w.OTag(name)
+			parents = append(parents, name)
+		}
+	}
+	defer setParents(nil)
+
+	for i := range ti.fields {
+		f := &ti.fields[i]
+		fv := fieldByIndex(val, f.idx, false)
+		if !fv.IsValid() {
+			continue
+		}
+		switch f.flags & fMode {
+		case fElement, fAny:
+			if isNilValue(fv) || (f.flags&fOmitEmpty != 0 && isEmptyValue(fv)) {
+				continue
+			}
+			setParents(f.parents)
+			if err := marshalElement(w, f.name, fv, f.flags&fAny != 0); err != nil {
+				return err
+			}
+			continue
+		}
+		setParents(nil)
+		switch f.flags & fMode {
+		case fCharData:
+			s, err := marshalToStr(fv)
+			if err != nil {
+				return err
+			}
+			if s == "" {
+				break
+			}
+			if f.flags&fCData != 0 {
+				w.CData(s)
+			} else {
+				w.BeginContent()
+				w.scramblestr(s)
+			}
+		case fInnerXML:
+			s, err := marshalToStr(fv)
+			if err != nil {
+				return err
+			}
+			if s != "" {
+				w.BeginContent()
+				w.text(s)
+				w.put(s)
+			}
+		case fComment:
+			s, err := marshalToStr(fv)
+			if err != nil {
+				return err
+			}
+			if s != "" {
+				w.Comment(s)
+			}
+		}
+	}
+	return nil
+}
+
+// marshalAttr writes the named attribute, AttrMarshaler values write their
+// own attributes
+func marshalAttr(w *Writer, name string, val reflect.Value, omitEmpty bool) error {
+	if m := attrMarshaler(val); m != nil {
+		return m.MarshalXGAttr(name, w)
+	}
+	s, err := marshalToStr(val)
+	if err != nil {
+		return err
+	}
+	if omitEmpty && s == "" {
+		return nil
+	}
+	w.StringAttr(name, s)
+	return nil
+}
+
+// attrMarshaler returns the AttrMarshaler implementation of a value, looking
+// through pointers and interfaces
+func attrMarshaler(val reflect.Value) AttrMarshaler {
+	for val.IsValid() {
+		if val.CanInterface() && !isNilValue(val) {
+			if m, ok := val.Interface().(AttrMarshaler); ok {
+				return m
+			}
+		}
+		if val.CanAddr() && val.Addr().CanInterface() {
+			if m, ok := val.Addr().Interface().(AttrMarshaler); ok {
+				return m
+			}
+		}
+		if !isNilValue(val) && (val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface) {
+			val = val.Elem()
+			continue
+		}
+		break
+	}
+	return nil
+}
+
+// marshalElement writes val wrapped into an element, slices produce one
+// element per item. With byValue, the XMLName of a struct value takes
+// precedence over the name. Interface values of registered types are named
+// after their registration, the namespace is declared as with OTagNS.
+func marshalElement(w *Writer, name string, val reflect.Value, byValue bool) error {
+	uri := ""
+	if val.Kind() == reflect.Interface && !val.IsNil() {
+		if n, ok := w.getRegistry().nameOf(val.Elem().Type()); ok {
+			name, uri, byValue = n.local, n.uri, false
+		}
+	}
+	for val.Kind() == reflect.Interface || val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+	kind := val.Kind()
+	if (kind == reflect.Slice || kind == reflect.Array) && val.Type().Elem().Kind() != reflect.Uint8 &&
+		!implementsMarshaler(val) {
+		for i, n := 0, val.Len(); i < n; i++ {
+			if err := marshalElement(w, name, val.Index(i), byValue); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if byValue && kind == reflect.Struct {
+		ti, err := getTypeInfo(val.Type())
+		if err != nil {
+			return err
+		}
+		if s := ti.elementName(val); s != "" {
+			name = s
+		}
+	}
+	if uri != "" {
+		w.OTagNS(uri, name)
+	} else {
+		w.OTag(name)
+	}
+	if err := marshalToContent(w, val); err != nil {
+		return err
+	}
+	w.CTag()
+	return nil
+}
+
+// elementName returns the name stored in the XMLName field, or its tag name
+func (ti *typeInfo) elementName(val reflect.Value) string {
+	if ti.xmlname == nil {
+		return ""
+	}
+	if fv := fieldByIndex(val, ti.xmlname.idx, false); fv.IsValid() {
+		switch {
+		case fv.Type() == xmlNameType:
+			if local := fv.Interface().(xml.Name).Local; local != "" {
+				return local
+			}
+		case fv.Kind() == reflect.String && fv.String() != "":
+			return fv.String()
+		}
+	}
+	return ti.xmlname.name
+}
+
+func implementsMarshaler(val reflect.Value) bool {
+	typ := val.Type()
+	if typ.Implements(marshalerType) || typ.Implements(textMarshalerType) {
+		return true
+	}
+	if val.CanAddr() {
+		pt := reflect.PtrTo(typ)
+		return pt.Implements(marshalerType) || pt.Implements(textMarshalerType)
+	}
+	return false
+}
+
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
 func marshalTextMarshalerToStr(v encoding.TextMarshaler) (string, error) {
 	b, e := v.MarshalText()
 	return string(b), e
@@ -0,0 +1,192 @@
+package xg
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type encodePoint struct {
+	X int `xg:"x,attr"`
+	Y int `xg:"y,attr,omitempty"`
+}
+
+type encodeShape struct {
+	encodePoint
+	Label   string        `xg:"label,attr,omitempty"`
+	Note    *string       `xg:"note,attr"`
+	Comment string        `xg:",comment"`
+	Points  []encodePoint `xg:"pt"`
+	Tags    []string      `xg:"tag,omitempty"`
+	Title   string        `xg:"title,omitempty"`
+	Size    float64
+	Origin  *encodePoint `xg:"origin"`
+	Hidden  string       `xg:"-"`
+	Raw     string       `xg:",innerxml"`
+	Text    string       `xg:",chardata"`
+}
+
+func (l decodeLevel) MarshalText() ([]byte, error) {
+	return []byte([]string{"", "low", "high"}[l]), nil
+}
+
+func TestWriteStruct(t *testing.T) {
+	note := "a&b"
+	v := encodeShape{
+		encodePoint: encodePoint{X: 1},
+		Note:        &note,
+		Comment:     "shape",
+		Points:      []encodePoint{{1, 2}, {3, 0}},
+		Size:        2.5,
+		Hidden:      "hidden",
+		Raw:         "<raw/>",
+		Text:        "x<y",
+	}
+	out := &bytes.Buffer{}
+	w := NewWriter(out)
+	w.OTag("shape")
+	w.Write(v)
+	w.CTag()
+
+	want := `<shape x="1" note="a&amp;b"><!--shape--><pt x="1" y="2" /><pt x="3" /><Size>2.5</Size><raw/>x&lt;y</shape>`
+	if got := out.String(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	// after the tag is closed, attribute fields are not written
+	out.Reset()
+	w.OTag("shape")
+	w.BeginContent()
+	w.Write(&encodeShape{Title: "t", Origin: &encodePoint{5, 6}})
+	w.CTag()
+	want = `<shape><title>t</title><Size>0</Size><origin x="5" y="6" /></shape>`
+	if got := out.String(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	// struct attribute values use their character data
+	out.Reset()
+	w.OTag("a")
+	w.Attr("v", struct {
+		Text string `xg:",chardata"`
+		N    int    `xg:"n,attr"`
+	}{"text", 1})
+	w.CTag()
+	if got := out.String(); got != `<a v="text" />` {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestWriteStructRoundTrip(t *testing.T) {
+	yes := true
+	in := decodeConfig{
+		Version: 1.5,
+		Name:    "main & only",
+		Servers: []decodeServer{
+			{decodeBase: decodeBase{ID: "a", Note: "first"}, Port: 80, Level: 1, Address: "10.0.0.1"},
+			{decodeBase: decodeBase{ID: "b"}, Port: 81, Secure: &yes, Address: "10.0.0.2"},
+		},
+		Tags: []string{"x", "y"},
+	}
+	out := &bytes.Buffer{}
+	w := NewWriter(out)
+	w.OTag("config")
+	w.Write(in)
+	w.CTag()
+
+	var got decodeConfig
+	if err := Unmarshal(out.String(), &got); err != nil {
+		t.Fatal(err)
+	}
+	in.Raw = got.Raw
+	in.Limits = got.Limits
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("got  %+v\nwant %+v\n%s", got, in, out.String())
+	}
+}
+
+// attrPoint is written as two attributes with the field name as prefix
+type attrPoint struct {
+	X, Y int
+}
+
+func (p attrPoint) MarshalXGAttr(name string, w *Writer) error {
+	w.Attr(name+"x", p.X)
+	w.Attr(name+"y", p.Y)
+	return nil
+}
+
+func (p *attrPoint) UnmarshalXGAttr(name string, attrs AttributeList) error {
+	for _, c := range []struct {
+		suffix string
+		v      *int
+	}{{"x", &p.X}, {"y", &p.Y}} {
+		if s, ok := attrs.Attr(name + c.suffix); ok {
+			if _, err := fmt.Sscan(s, c.v); err != nil {
+				return fmt.Errorf("invalid coordinate %q", s)
+			}
+		}
+	}
+	return nil
+}
+
+// attrFlag is omitted when not set
+type attrFlag bool
+
+func (f attrFlag) MarshalXGAttr(name string, w *Writer) error {
+	if f {
+		w.StringAttr(name, name)
+	}
+	return nil
+}
+
+func (f *attrFlag) UnmarshalXGAttr(name string, attrs AttributeList) error {
+	_, ok := attrs.Attr(name)
+	*f = attrFlag(ok)
+	return nil
+}
+
+func TestAttrMarshaler(t *testing.T) {
+	type line struct {
+		From    attrPoint  `xg:"from,attr"`
+		To      *attrPoint `xg:"to,attr"`
+		Dashed  attrFlag   `xg:"dashed,attr"`
+		Visible attrFlag   `xg:"visible,attr"`
+	}
+	in := line{From: attrPoint{1, 2}, To: &attrPoint{3, 4}, Visible: true}
+
+	out := &bytes.Buffer{}
+	w := NewWriter(out)
+	w.OTag("line")
+	w.Write(in)
+	w.CTag()
+	want := `<line fromx="1" fromy="2" tox="3" toy="4" visible="visible" />`
+	if got := out.String(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	var got line
+	ci := Open(out.String())
+	ci.SetStrict(StrictError)
+	if err := ci.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.From != in.From || got.To == nil || *got.To != *in.To || got.Dashed || !got.Visible {
+		t.Errorf("got %+v", got)
+	}
+
+	out.Reset()
+	w.OTag("p")
+	w.Attr("at", &attrPoint{5, 6})
+	w.OptAttr("hidden", attrFlag(false))
+	w.CTag()
+	if got := out.String(); got != `<p atx="5" aty="6" />` {
+		t.Errorf("got %s", got)
+	}
+
+	err := Unmarshal(`<line fromx="1" fromy="z"/>`, &got)
+	if err == nil || err.Error() != `xml decoder [1:7] /line/@from: invalid coordinate "z"` {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
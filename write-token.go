@@ -0,0 +1,116 @@
+package xg
+
+import (
+	"errors"
+	"strings"
+)
+
+// Token writes a parsed token, so that documents can be filtered and
+// transformed as a stream, see Transform.
+//
+// Tags, attributes and end tags follow the tag structure of the writer: an
+// EndContent token closes the open element whatever its name, so renaming a
+// Tag token is enough to rename an element. Character data and attribute
+// values are RawString values, they are written in their raw form and must be
+// well-formed, quotes inside attribute values are escaped as needed. Comments,
+// CDATA sections and processing instructions are written like with Comment,
+// CData and PI. At the document level, the white space preceding a token is
+// preserved. Err tokens are recorded as errors, see Err.
+func (w *Writer) Token(t *Token) {
+	if t == nil {
+		return
+	}
+	if len(w.names) == 0 && !w.inOtag && t.WhitePrefix != "" {
+		w.put(t.WhitePrefix)
+		w.midLine = !strings.HasSuffix(t.WhitePrefix, "\n")
+	}
+	switch t.Kind {
+	case XmlDecl:
+		if strings.HasPrefix(t.Raw, "<?xml") {
+			w.beginMarkup()
+			w.put(t.Raw)
+		} else {
+			w.XmlDecl()
+		}
+	case DocTypeDecl:
+		w.beginMarkup()
+		w.put("<!DOCTYPE ")
+		w.put(string(t.Name))
+		if t.Value != "" {
+			w.put(" ")
+			w.put(string(t.Value))
+		}
+		w.put(">")
+	case Tag:
+		w.OTag(string(t.Name))
+	case Attrib:
+		if !w.inOtag {
+			w.misuse("xml writer: trying to write an attribute outside of an open tag")
+			return
+		}
+		if !isRawText(t.Value, true) {
+			w.fail(errors.New("xml writer: attribute " + string(t.Name) + " has an invalid raw value"))
+		}
+		q := w.beginAttr(string(t.Name), t.Value.Unscrambled())
+		if q == `"` {
+			w.put(strings.ReplaceAll(string(t.Value), q, "&quot;"))
+		} else {
+			w.put(strings.ReplaceAll(string(t.Value), q, "&apos;"))
+		}
+		w.put(q)
+	case BeginContent:
+		w.BeginContent()
+	case CloseEmptyTag, EndContent:
+		w.CTag()
+	case SData:
+		if !isRawText(t.Value, false) {
+			w.fail(errors.New("xml writer: invalid raw character data"))
+		}
+		w.Raw(string(t.Value))
+	case CData:
+		w.CData(string(t.Value))
+	case Comment:
+		w.Comment(string(t.Value))
+	case PI:
+		w.PI(string(t.Name), string(t.Value))
+	case Err:
+		w.fail(t.Error)
+	}
+}
+
+// isRawText reports whether s is well-formed escaped character data or,
+// with attr, an escaped attribute value
+func isRawText(s RawString, attr bool) bool {
+	if strings.IndexByte(string(s), '<') >= 0 || badReference(string(s)) >= 0 {
+		return false
+	}
+	return attr || !strings.Contains(string(s), "]]>")
+}
+
+// Transform parses the document in and writes it to w token by token. Each
+// token passes through fn, which returns the tokens to write in its place:
+// the token itself to keep it, nothing to drop it, or modified and additional
+// tokens. A nil fn copies the document. Transform streams the document
+// without building a tree, flushes w and returns the first parsing or
+// writing error.
+func Transform(in string, w *Writer, fn func(t *Token) []*Token) error {
+	tt := &tokenizer{buf: in}
+	for w.err == nil {
+		t := tt.Next()
+		if t.Kind == Err {
+			w.Flush()
+			return t.Error
+		}
+		if fn == nil {
+			w.Token(t)
+		} else {
+			for _, r := range fn(t) {
+				w.Token(r)
+			}
+		}
+		if t.Kind == EOF {
+			break
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,104 @@
+package xg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const transformSample = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE doc [<!ENTITY e "x">]>
+<!-- head -->
+<doc a='say "hi"' b="&lt;&amp;">
+	<item id="1">one &amp; <![CDATA[<two>]]></item>
+	<!-- drop -->
+	<item id="2"/><?pi data?>
+</doc>
+`
+
+func TestTransform(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := NewWriter(out)
+	w.SetOptions(WriterOptions{EmptyElement: EmptySlash})
+	if err := Transform(transformSample, w, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(transformSample, `a='say "hi"'`, `a="say &quot;hi&quot;"`, 1)
+	if got := out.String(); got != want {
+		t.Errorf("copy\ngot  %s\nwant %s", got, want)
+	}
+
+	out.Reset()
+	w = NewWriter(out)
+	inItem := false
+	err := Transform(transformSample, w, func(tok *Token) []*Token {
+		switch tok.Kind {
+		case Comment:
+			if strings.TrimSpace(string(tok.Value)) == "drop" {
+				return nil
+			}
+		case Tag:
+			if tok.Name == "item" {
+				inItem = true
+				renamed := *tok
+				renamed.Name = "entry"
+				return []*Token{&renamed, {Kind: Attrib, Name: "new", Value: "1 &gt; 0"}}
+			}
+		case Attrib:
+			if inItem && tok.Name == "id" {
+				tok.Name = "key"
+			}
+		case BeginContent, CloseEmptyTag:
+			inItem = false
+		case SData:
+			return []*Token{tok, {Kind: SData, Value: "!"}}
+		}
+		return []*Token{tok}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE doc [<!ENTITY e "x">]>
+<!-- head -->
+<doc a="say &quot;hi&quot;" b="&lt;&amp;">
+	!<entry new="1 &gt; 0" key="1">one &amp; !<![CDATA[<two>]]></entry>
+	!
+	!<entry new="1 &gt; 0" key="2" /><?pi data?>
+!</doc>
+`
+	if got := out.String(); got != want {
+		t.Errorf("filter\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestTransformErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		fn   func(tok *Token) []*Token
+		err  string
+	}{
+		{"parse", "<a></b>", nil, "xml parser [1:4]: mismatching tag"},
+		{"raw text", "<a>x</a>", func(tok *Token) []*Token {
+			if tok.Kind == SData {
+				tok.Value = "a < b"
+			}
+			return []*Token{tok}
+		}, "xml writer: invalid raw character data"},
+		{"raw attr", "<a x='1'/>", func(tok *Token) []*Token {
+			if tok.Kind == Attrib {
+				tok.Value = "&x"
+			}
+			return []*Token{tok}
+		}, "xml writer: attribute x has an invalid raw value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Transform(tt.in, NewWriter(&bytes.Buffer{}), tt.fn)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("got %v\nwant %s", err, tt.err)
+			}
+		})
+	}
+}
@@ -1,26 +1,160 @@
 package xg
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"reflect"
 	"strings"
+	"unicode/utf8"
 )
 
+// Writer writes XML to an underlying io.Writer.
+//
+// The first error, either from the underlying writer or from marshaling a
+// value, is recorded and turns the following writes into no-ops, see Err.
 type Writer struct {
 	out           io.Writer
+	buf           *bufio.Writer // nil when out is written directly
+	err           error
 	names         []string
 	inOtag        bool
 	indentLevel   int
 	prevLineLevel int
-	indentSpaces  int // when 0 (default), indent with tabs
+	opts          WriterOptions
+	registry      *TypeRegistry
+
+	// namespace state, see OTagNS
+	bindings []nsBinding
+	prefixes map[string]string // preferred prefixes by namespace URI
+	nsCount  int               // number of generated prefixes
+
+	// well-formedness state, see WriterOptions.Check
+	roots     int      // number of root elements
+	attrNames []string // attributes of the open tag
+
+	// auto-indent state
+	midLine  bool // the current line has output
+	hasChild bool // the current element has child markup
+	mixed    int  // depth of the outermost open element with text, 0 if none
+	held     bytes.Buffer
+	heldOut  io.Writer   // destination of the held output, nil when not holding
+	breaks   []heldBreak // line breaks of the held output
+}
+
+// heldBreak is a line break in auto-indent mode that is written unless an
+// element that contains it turns out to have text
+type heldBreak struct {
+	pos   int  // offset in the held output
+	owner int  // depth of the element whose content has the break
+	level int  // indentation level
+	nl    bool // start a new line
 }
 
+// EmptyElementStyle selects how elements without content are written
+type EmptyElementStyle int
+
+const (
+	EmptySpaceSlash = EmptyElementStyle(iota) // <a /> (default)
+	EmptySlash                                // <a/>
+	EmptyPair                                 // <a></a>
+)
+
+// InvalidCharPolicy selects how the Writer handles control characters,
+// invalid UTF-8 and other characters that cannot appear in XML 1.0 text,
+// attribute values, comments, CDATA sections and processing instructions
+type InvalidCharPolicy int
+
+const (
+	InvalidCharReplace = InvalidCharPolicy(iota) // replace with U+FFFD (default)
+	InvalidCharError                             // record an error, see Writer.Err
+	InvalidCharDrop                              // drop
+	InvalidCharXML11                             // write character references allowed by XML 1.1, XmlDecl declares version 1.1
+)
+
+// WriterOptions control the formatting of the output, the zero value is the
+// default style
+type WriterOptions struct {
+	IndentSpaces int               // indent with the number of spaces, 0 indents with tabs
+	CRLF         bool              // end lines with \r\n instead of \n
+	SingleQuote  bool              // quote attribute values with ' instead of "
+	EmptyElement EmptyElementStyle // style of elements without content
+
+	// InvalidChars selects how characters that XML 1.0 does not allow are
+	// written, along with -- and a trailing - in comments
+	InvalidChars InvalidCharPolicy
+
+	// Check verifies that the output is well-formed: names are valid, no
+	// attribute appears twice on an element, there is exactly one root
+	// element and all tags are closed by Close. Violations and API misuse
+	// are recorded as errors instead of panics, see Err.
+	Check bool
+
+	// AutoIndent puts child elements, comments and processing instructions
+	// on lines of their own, the + prefix of tag names is ignored. Elements
+	// with text keep all their content on one line, so that text is written
+	// as is. As the kind of content is known only when an element closes,
+	// the output within the root element is held back until the root
+	// element is closed, or until Close.
+	AutoIndent bool
+
+	// MinimalEscaping leaves >, ' and " unescaped in text, and the quote
+	// character that is not used for attribute values. The > of a ]]>
+	// sequence in text is always escaped.
+	MinimalEscaping bool
+}
+
+// NewWriter returns a Writer that writes directly to out
 func NewWriter(out io.Writer) *Writer {
 	return &Writer{out: out}
 }
 
+// NewBufferedWriter returns a Writer that buffers its output, call Flush or
+// Close when done
+func NewBufferedWriter(out io.Writer) *Writer {
+	buf := bufio.NewWriter(out)
+	return &Writer{out: buf, buf: buf}
+}
+
+// SetOptions changes the formatting of the output
+func (w *Writer) SetOptions(opts WriterOptions) {
+	w.opts = opts
+}
+
+// Options returns the formatting options of w
+func (w *Writer) Options() WriterOptions {
+	return w.opts
+}
+
+// Err returns the first error that occurred while writing
+func (w *Writer) Err() error {
+	return w.err
+}
+
+// Flush writes buffered output to the underlying writer and returns the
+// first error that occurred while writing. Output held back in auto-indent
+// mode is written when the root element is closed, see Close.
+func (w *Writer) Flush() error {
+	if w.err == nil && w.buf != nil {
+		w.err = w.buf.Flush()
+	}
+	return w.err
+}
+
+// fail records err unless an error was recorded already
+func (w *Writer) fail(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
+
 func (w *Writer) put(s string) {
-	w.out.Write([]byte(s))
+	if w.err == nil && s != "" {
+		_, w.err = io.WriteString(w.out, s)
+		w.midLine = true
+	}
 }
 
 func (w *Writer) BeginContent() {
@@ -31,10 +165,13 @@ func (w *Writer) BeginContent() {
 }
 
 func (w *Writer) putIndent(level int) {
-	if w.indentSpaces > 0 {
-		writeSpaces(w.out, level*w.indentSpaces)
+	if w.err != nil {
+		return
+	}
+	if w.opts.IndentSpaces > 0 {
+		w.err = writeSpaces(w.out, level*w.opts.IndentSpaces)
 	} else {
-		writeTabs(w.out, level)
+		w.err = writeTabs(w.out, level)
 	}
 }
 
@@ -43,17 +180,40 @@ func (w *Writer) BOM() {
 }
 
 func (w *Writer) XmlDecl() {
-	if len(w.names) > 0 {
-		panic("xml writer: invalid XmlDecl placement")
+	if len(w.names) > 0 || (w.opts.Check && w.roots > 0) {
+		w.misuse("xml writer: invalid XmlDecl placement")
+		return
+	}
+	if w.opts.InvalidChars == InvalidCharXML11 {
+		w.put(`<?xml version="1.1" encoding="UTF-8"?>`)
+	} else {
+		w.put(`<?xml version="1.0" encoding="UTF-8"?>`)
 	}
-	w.put(`<?xml version="1.0" encoding="UTF-8"?>\n`)
+	w.newline()
 }
 
 const nolevel = -1
 
 func (w *Writer) OTag(name string) {
 	if len(name) == 0 || name == "+" {
-		panic("xml writer: trying to write a tag with empty name")
+		w.misuse("xml writer: trying to write a tag with empty name")
+		return
+	}
+	if len(w.names) == 0 {
+		w.roots++
+	}
+	if w.opts.Check {
+		w.checkTag(strings.TrimPrefix(name, "+"))
+	}
+	if w.opts.AutoIndent {
+		w.beginMarkup()
+		w.hasChild = false
+		name = strings.TrimPrefix(name, "+")
+		w.names = append(w.names, name)
+		w.put("<")
+		w.put(name)
+		w.inOtag = true
+		return
 	}
 	prevLevel := w.prevLineLevel
 	w.BeginContent()
@@ -63,7 +223,7 @@ func (w *Writer) OTag(name string) {
 		name = name[1:]
 		w.indentLevel++
 		if prevLevel == nolevel || prevLevel > w.indentLevel {
-			w.put("\n")
+			w.newline()
 			w.putIndent(w.indentLevel)
 		} else {
 			w.putIndent(w.indentLevel - prevLevel)
@@ -75,146 +235,375 @@ func (w *Writer) OTag(name string) {
 	w.prevLineLevel = nolevel
 }
 
-func (w *Writer) scramblestr(s string) {
-	encodeEOLs := false
-	if w.inOtag {
-		encodeEOLs = true
+func (w *Writer) newline() {
+	if w.opts.CRLF {
+		w.put("\r\n")
+	} else {
+		w.put("\n")
+	}
+	w.midLine = false
+}
+
+// beginMarkup starts child markup, in auto-indent mode it goes on a new line
+// unless the current element has text
+func (w *Writer) beginMarkup() {
+	w.BeginContent()
+	if !w.opts.AutoIndent {
+		return
+	}
+	w.hasChild = true
+	if w.mixed != 0 {
+		return
+	}
+	if len(w.names) == 0 {
+		if w.midLine {
+			w.newline()
+		}
+		return
+	}
+	w.holdBreak(len(w.names), len(w.names))
+}
+
+// holdBreak records a line break within the content of the element at the
+// owner depth, holding back the output until the root element is closed
+func (w *Writer) holdBreak(owner, level int) {
+	if w.heldOut == nil {
+		w.heldOut, w.out = w.out, &w.held
+	}
+	w.breaks = append(w.breaks, heldBreak{pos: w.held.Len(), owner: owner, level: level, nl: w.midLine})
+	w.midLine = true
+}
+
+// dropBreaks removes the held line breaks within an element that has text
+func (w *Writer) dropBreaks(depth int) {
+	n := 0
+	for _, b := range w.breaks {
+		if b.owner < depth {
+			w.breaks[n] = b
+			n++
+		}
+	}
+	w.breaks = w.breaks[:n]
+}
+
+// release writes the held output with its line breaks
+func (w *Writer) release() {
+	if w.heldOut == nil {
+		return
+	}
+	w.out, w.heldOut = w.heldOut, nil
+	held, o := w.held.String(), 0
+	for _, b := range w.breaks {
+		w.put(held[o:b.pos])
+		o = b.pos
+		if b.nl {
+			w.newline()
+		}
+		w.putIndent(b.level)
+	}
+	w.put(held[o:])
+	w.held.Reset()
+	w.breaks = w.breaks[:0]
+}
+
+// text marks the current element as mixed content, auto-indent mode keeps
+// the rest of it on the current line
+func (w *Writer) text(s string) {
+	if w.opts.Check && len(w.names) == 0 && strings.Trim(s, " \t\r\n") != "" {
+		w.fail(errors.New("xml writer: text outside of the root element"))
+	}
+	if w.mixed == 0 && len(w.names) > 0 {
+		w.mixed = len(w.names)
+		w.dropBreaks(w.mixed)
 	}
+}
+
+// scramblestr writes escaped text, or an escaped attribute value while the
+// tag is open
+func (w *Writer) scramblestr(s string) {
+	inAttr := w.inOtag
+	minimal := w.opts.MinimalEscaping
 	i, o, n := 0, 0, len(s)
 	if n <= 0 {
 		return
 	}
+	if !inAttr {
+		w.text(s)
+	}
 	for i < n {
 		c := s[i]
-		i++
-		switch c {
-		case '&':
-			w.put(s[o : i-1])
-			w.put("&amp;")
-			o = i
-		case '<':
-			w.put(s[o : i-1])
-			w.put("&lt;")
-			o = i
-		case '>':
-			w.put(s[o : i-1])
-			w.put("&gt;")
-			o = i
-		case '\'':
-			w.put(s[o : i-1])
-			w.put("&apos;")
-			o = i
-		case '"':
-			w.put(s[o : i-1])
-			w.put("&quot;")
+		size := 1
+		esc, hit := "", true
+		switch {
+		case c == '&':
+			esc = "&amp;"
+		case c == '<':
+			esc = "&lt;"
+		case c == '>':
+			hit = !minimal || (!inAttr && i >= 2 && s[i-2:i] == "]]")
+			esc = "&gt;"
+		case c == '\'':
+			hit = !minimal || (inAttr && w.opts.SingleQuote)
+			esc = "&apos;"
+		case c == '"':
+			hit = !minimal || (inAttr && !w.opts.SingleQuote)
+			esc = "&quot;"
+		case c == '\t' && !inAttr:
+			hit = false
+		case (c == '\r' || c == '\n') && !inAttr:
+			w.put(s[o:i])
+			w.newline()
+			i++
+			if c == '\r' && i < n && s[i] == '\n' {
+				i++
+			}
 			o = i
+			continue
+		case c == '\t' || c == '\r' || c == '\n':
+			var buf [5]byte
+			buf[0] = '&'
+			buf[1] = '#'
+			buf[2] = uint8('0') + c/10
+			buf[3] = uint8('0') + c%10
+			buf[4] = ';'
+			esc = string(buf[:])
+		case c < ' ':
+			esc = w.invalidChar(rune(c), true)
+		case c < 0x7f:
+			hit = false
 		default:
-			if c < ' ' {
-				w.put(s[o : i-1])
-				if !encodeEOLs && (c == '\r' || c == '\n') {
-					w.put("\n")
-					if c == '\r' && i < n && s[i] == 'n' {
-						i++
-					}
-				} else {
-					var buf [5]byte
-					buf[0] = '&'
-					buf[1] = '#'
-					buf[2] = uint8('0') + c/10
-					buf[3] = uint8('0') + c%10
-					buf[4] = ';'
-					w.out.Write(buf[:])
-				}
-				o = i
+			var r rune
+			r, size = utf8.DecodeRuneInString(s[i:])
+			if isChar(r, size) && !(w.opts.InvalidChars == InvalidCharXML11 && r <= 0x9f) {
+				hit = false
+			} else {
+				esc = w.invalidChar(r, size > 1)
 			}
 		}
+		if hit {
+			w.put(s[o:i])
+			w.put(esc)
+			o = i + size
+		}
+		i += size
 	}
 	w.put(s[o:n])
 }
 
+// isChar reports whether r, decoded from size bytes, is allowed by XML 1.0
+// outside of the C0 controls
+func isChar(r rune, size int) bool {
+	return !(r == utf8.RuneError && size == 1) && r != 0xfffe && r != 0xffff
+}
+
+// invalidChar returns the replacement of a character that XML 1.0 does not
+// allow, r is utf8.RuneError for invalid UTF-8. With refs, XML 1.1 policy
+// writes character references.
+func (w *Writer) invalidChar(r rune, refs bool) string {
+	switch w.opts.InvalidChars {
+	case InvalidCharError:
+		if r == utf8.RuneError {
+			w.fail(errors.New("xml writer: invalid UTF-8"))
+		} else {
+			w.fail(fmt.Errorf("xml writer: invalid character %U", r))
+		}
+		return ""
+	case InvalidCharDrop:
+		return ""
+	case InvalidCharXML11:
+		if refs && r != 0 && r != utf8.RuneError && r < 0xfffe {
+			return fmt.Sprintf("&#x%X;", r)
+		}
+	}
+	return "\uFFFD"
+}
+
+// validChars applies the invalid character policy to text that cannot
+// contain references, like comments and CDATA sections
+func (w *Writer) validChars(s string) string {
+	var b strings.Builder
+	o := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= ' ' && c < 0x7f || c == '\t' || c == '\r' || c == '\n' {
+			i++
+			continue
+		}
+		r, size := rune(c), 1
+		if c >= 0x7f {
+			r, size = utf8.DecodeRuneInString(s[i:])
+			if isChar(r, size) && !(w.opts.InvalidChars == InvalidCharXML11 && r <= 0x9f) {
+				i += size
+				continue
+			}
+		}
+		b.WriteString(s[o:i])
+		b.WriteString(w.invalidChar(r, false))
+		i += size
+		o = i
+	}
+	if o == 0 {
+		return s
+	}
+	b.WriteString(s[o:])
+	return b.String()
+}
+
+// commentText applies the invalid character policy to the text of a comment,
+// which cannot contain -- or end with -
+func (w *Writer) commentText(s string) string {
+	s = w.validChars(s)
+	if !strings.Contains(s, "--") && !strings.HasSuffix(s, "-") {
+		return s
+	}
+	switch w.opts.InvalidChars {
+	case InvalidCharError:
+		w.fail(fmt.Errorf("xml writer: comment %q contains -- or ends with -", s))
+	case InvalidCharDrop:
+		for strings.Contains(s, "--") {
+			s = strings.ReplaceAll(s, "--", "-")
+		}
+		s = strings.TrimSuffix(s, "-")
+	default:
+		s = padComment(s)
+	}
+	return s
+}
+
+// padComment separates the dashes of -- and pads a trailing - with a space,
+// which makes s valid comment text
+func padComment(s string) string {
+	for strings.Contains(s, "--") {
+		s = strings.ReplaceAll(s, "--", "- -")
+	}
+	if strings.HasSuffix(s, "-") {
+		s += " "
+	}
+	return s
+}
+
 func (w *Writer) String(s string) {
 	w.BeginContent()
 	w.scramblestr(s)
 }
 
+// Write writes v as content. Structs are written according to their xg
+// field tags, see Unmarshal. When the tag is still open, attribute fields are
+// added to it. Marshaling errors are recorded, see Err.
 func (w *Writer) Write(v interface{}) {
-	w.BeginContent()
-	toContent(w, v)
+	if w.err == nil {
+		w.fail(toContent(w, v))
+	}
 }
 
 func (w *Writer) Comment(s string) {
-	w.BeginContent()
+	w.beginMarkup()
 	w.put("<!--")
-	w.put(strings.ReplaceAll(s, "--", "-")) // make sure double-dash is not written
+	w.put(w.commentText(s))
 	w.put("-->")
 }
 
-func (w *Writer) StringAttr(name string, value string) {
-	if !w.inOtag {
-		panic("xml writer: trying to write an attribute outside of an open tag")
+func (w *Writer) putAttr(name string, value string) {
+	q := w.beginAttr(name, value)
+	w.scramblestr(value)
+	w.put(q)
+}
+
+// beginAttr writes the attribute name and the opening quote, value is the
+// unescaped value of namespace declarations
+func (w *Writer) beginAttr(name string, value string) (quote string) {
+	if w.opts.Check {
+		w.checkAttr(name)
+	}
+	if name == "xmlns" || strings.HasPrefix(name, "xmlns:") {
+		w.bind(strings.TrimPrefix(strings.TrimPrefix(name, "xmlns"), ":"), value)
+	}
+	q := `"`
+	if w.opts.SingleQuote {
+		q = "'"
 	}
 	w.put(" ")
 	w.put(name)
-	w.put(`="`)
-	w.scramblestr(value)
-	w.put(`"`)
+	w.put("=")
+	w.put(q)
+	return q
 }
 
+func (w *Writer) StringAttr(name string, value string) {
+	if !w.inOtag {
+		w.misuse("xml writer: trying to write an attribute outside of an open tag")
+		return
+	}
+	w.putAttr(name, value)
+}
+
+// Attr writes an attribute, values that implement AttrMarshaler write their
+// own attributes. Marshaling errors are recorded, see Err.
 func (w *Writer) Attr(name string, value interface{}) {
 	if !w.inOtag {
-		panic("xml writer: trying to write an attribute outside of an open tag")
+		w.misuse("xml writer: trying to write an attribute outside of an open tag")
+		return
+	}
+	if w.err == nil {
+		w.fail(marshalAttr(w, name, reflect.ValueOf(value), false))
 	}
-	s, _ := toStr(value)
-	w.put(" ")
-	w.put(name)
-	w.put(`="`)
-	w.scramblestr(s)
-	w.put(`"`)
 }
 
 func (w *Writer) OptStringAttr(name string, value string) {
 	if !w.inOtag {
-		panic("xml writer: trying to write an attribute outside of an open tag")
+		w.misuse("xml writer: trying to write an attribute outside of an open tag")
+		return
 	}
 	if len(value) == 0 {
 		return
 	}
-	w.put(" ")
-	w.put(name)
-	w.put(`="`)
-	w.scramblestr(value)
-	w.put(`"`)
+	w.putAttr(name, value)
 }
 
 func (w *Writer) OptAttr(name string, value interface{}) {
 	if !w.inOtag {
-		panic("xml writer: trying to write an attribute outside of an open tag")
-	}
-	s, _ := toStr(value)
-	if len(s) == 0 {
+		w.misuse("xml writer: trying to write an attribute outside of an open tag")
 		return
 	}
-	w.put(" ")
-	w.put(name)
-	w.put(`="`)
-	w.scramblestr(s)
-	w.put(`"`)
+	if w.err == nil {
+		w.fail(marshalAttr(w, name, reflect.ValueOf(value), true))
+	}
 }
 
 func (w *Writer) CTag() {
 	if len(w.names) == 0 {
-		panic("xml writer: tag stack underflow")
+		w.misuse("xml writer: tag stack underflow")
+		return
 	}
 	name := w.names[len(w.names)-1]
 	w.names = w.names[:len(w.names)-1]
+	w.popBindings()
 
 	indented := name[0] == '+'
 	if indented {
 		name = name[1:]
 	}
+	if w.opts.AutoIndent {
+		if !w.inOtag && w.hasChild && w.mixed == 0 {
+			w.holdBreak(len(w.names)+1, len(w.names))
+		}
+		if w.mixed > len(w.names) {
+			w.mixed = 0
+		}
+		w.hasChild = true // for the parent
+	}
 	if w.inOtag {
 		w.inOtag = false
-		w.put(" />")
+		switch w.opts.EmptyElement {
+		case EmptySlash:
+			w.put("/>")
+		case EmptyPair:
+			w.put("></")
+			w.put(name)
+			w.put(">")
+		default:
+			w.put(" />")
+		}
 	} else {
 		w.put("</")
 		w.put(name)
@@ -222,10 +611,13 @@ func (w *Writer) CTag() {
 	}
 	if indented {
 		w.indentLevel--
-		w.put("\n")
+		w.newline()
 		w.putIndent(w.indentLevel)
 		w.prevLineLevel = w.indentLevel
 	}
+	if len(w.names) == 0 {
+		w.release()
+	}
 }
 
 var tabs = [8]byte{'\t', '\t', '\t', '\t', '\t', '\t', '\t', '\t'}
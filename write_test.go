@@ -2,6 +2,7 @@ package xg
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"testing"
 )
@@ -29,3 +30,257 @@ func WriteExample() {
 
 	fmt.Println(out.String())
 }
+
+// failWriter accepts n bytes and fails afterwards
+type failWriter struct {
+	n   int
+	out bytes.Buffer
+}
+
+var errFull = errors.New("disk full")
+
+func (fw *failWriter) Write(b []byte) (int, error) {
+	if len(b) > fw.n {
+		fw.out.Write(b[:fw.n])
+		n := fw.n
+		fw.n = 0
+		return n, errFull
+	}
+	fw.n -= len(b)
+	return fw.out.Write(b)
+}
+
+func TestWriterErrors(t *testing.T) {
+	t.Run("direct", func(t *testing.T) {
+		fw := &failWriter{n: 100}
+		w := NewWriter(fw)
+		w.OTag("a")
+		w.CTag()
+		if got := fw.out.String(); got != "<a />" {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("buffered", func(t *testing.T) {
+		fw := &failWriter{n: 100}
+		w := NewBufferedWriter(fw)
+		w.OTag("a")
+		w.String("text")
+		w.CTag()
+		if fw.out.Len() != 0 {
+			t.Errorf("output is not buffered: %q", fw.out.String())
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if got := fw.out.String(); got != "<a>text</a>" {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("sticky", func(t *testing.T) {
+		fw := &failWriter{n: 5}
+		w := NewWriter(fw)
+		w.OTag("+a")
+		w.String("text")
+		w.CTag()
+		if err := w.Flush(); err != errFull {
+			t.Fatalf("got %v", err)
+		}
+		w.OTag("b")
+		w.CTag()
+		if err := w.Flush(); err != errFull || w.Err() != errFull {
+			t.Errorf("got %v", err)
+		}
+		if got := fw.out.String(); got != "\t<a>t" {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("marshal", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		w := NewWriter(out)
+		w.OTag("a")
+		w.Attr("x", 1)
+		w.Attr("y", make(chan int))
+		w.Write("after")
+		w.CTag()
+		var ute *UnsupportedTypeError
+		if err := w.Err(); !errors.As(err, &ute) {
+			t.Errorf("got %v", err)
+		}
+		if got := out.String(); got != `<a x="1"` {
+			t.Errorf("got %q", got)
+		}
+		if err := w.WriteElement("b", 1); err != w.Err() {
+			t.Errorf("got %v", err)
+		}
+	})
+}
+
+func TestWriterOptions(t *testing.T) {
+	write := func(w *Writer) {
+		w.OTag("+doc")
+		w.OTag("+a")
+		w.StringAttr("q", `'"<>&`)
+		w.String("x > y 'z' \"w\" ]]>\n")
+		w.CTag()
+		w.OTag("+b")
+		w.CTag()
+		w.CTag()
+	}
+	tests := []struct {
+		name string
+		opts WriterOptions
+		want string
+	}{
+		{"default", WriterOptions{},
+			"\t<doc>\n\t\t<a q=\"&apos;&quot;&lt;&gt;&amp;\">x &gt; y &apos;z&apos; &quot;w&quot; ]]&gt;\n</a>\n\t\t<b />\n\t</doc>\n"},
+		{"spaces crlf", WriterOptions{IndentSpaces: 2, CRLF: true, EmptyElement: EmptySlash},
+			"  <doc>\r\n    <a q=\"&apos;&quot;&lt;&gt;&amp;\">x &gt; y &apos;z&apos; &quot;w&quot; ]]&gt;\r\n</a>\r\n    <b/>\r\n  </doc>\r\n"},
+		{"minimal", WriterOptions{MinimalEscaping: true, EmptyElement: EmptyPair},
+			"\t<doc>\n\t\t<a q=\"'&quot;&lt;>&amp;\">x > y 'z' \"w\" ]]&gt;\n</a>\n\t\t<b></b>\n\t</doc>\n"},
+		{"single quote", WriterOptions{MinimalEscaping: true, SingleQuote: true},
+			"\t<doc>\n\t\t<a q='&apos;\"&lt;>&amp;'>x > y 'z' \"w\" ]]&gt;\n</a>\n\t\t<b />\n\t</doc>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			w := NewWriter(out)
+			w.SetOptions(tt.opts)
+			write(w)
+			if got := out.String(); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriterAutoIndent(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := NewWriter(out)
+	w.SetOptions(WriterOptions{AutoIndent: true, IndentSpaces: 2})
+	w.XmlDecl()
+	w.Comment("top")
+	w.OTag("doc")
+	w.OTag("+empty")
+	w.CTag()
+	w.OTag("p")
+	w.String("Hello, ")
+	w.OTag("b")
+	w.OTag("i")
+	w.String("bold")
+	w.CTag()
+	w.CTag()
+	w.String("!")
+	w.CTag()
+	w.OTag("list")
+	w.Comment("items")
+	w.Write(struct {
+		Items []int `xg:"item"`
+	}{[]int{1, 2}})
+	w.CTag()
+	w.CTag()
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<!--top-->
+<doc>
+  <empty />
+  <p>Hello, <b><i>bold</i></b>!</p>
+  <list>
+    <!--items-->
+    <item>1</item>
+    <item>2</item>
+  </list>
+</doc>`
+	if got := out.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	doc, err := ParseDocument("<a><b>x</b><c><d/></c></a>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	w = NewWriter(out)
+	w.SetOptions(WriterOptions{AutoIndent: true, EmptyElement: EmptySlash})
+	w.Write(doc)
+	if got, want := out.String(), "<a>\n\t<b>x</b>\n\t<c>\n\t\t<d/>\n\t</c>\n</a>"; got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+
+	// mixed content that starts with an element
+	out.Reset()
+	w = NewWriter(out)
+	w.SetOptions(WriterOptions{AutoIndent: true})
+	w.OTag("doc")
+	w.OTag("p")
+	w.OTag("b")
+	w.String("Bold")
+	w.CTag()
+	w.String(" text")
+	w.CTag()
+	w.OTag("q")
+	w.OTag("b")
+	w.OTag("i")
+	w.CTag()
+	w.CTag()
+	w.String("x")
+	w.CTag()
+	w.OTag("r")
+	w.CTag()
+	if out.String() != "<doc>" {
+		t.Errorf("output is not held back: %q", out.String())
+	}
+	w.CTag()
+	if got, want := out.String(), "<doc>\n\t<p><b>Bold</b> text</p>\n\t<q><b><i /></b>x</q>\n\t<r />\n</doc>"; got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestWriterInvalidChars(t *testing.T) {
+	write := func(w *Writer) {
+		w.OTag("a")
+		w.StringAttr("x", "1\x01\t2")
+		w.String("b\x00c\xffd\u0085e￾fé")
+		w.Comment("-g--h\x02-")
+		w.CData("i\x03j")
+		w.CTag()
+	}
+	tests := []struct {
+		name   string
+		policy InvalidCharPolicy
+		want   string
+		err    string
+	}{
+		{"replace", InvalidCharReplace,
+			"<a x=\"1�&#09;2\">b�c�d\u0085e�fé<!---g- -h�- --><![CDATA[i�j]]></a>", ""},
+		{"drop", InvalidCharDrop,
+			"<a x=\"1&#09;2\">bcd\u0085efé<!---g-h--><![CDATA[ij]]></a>", ""},
+		{"xml11", InvalidCharXML11,
+			"<a x=\"1&#x1;&#09;2\">b�c�d&#x85;e�fé<!---g- -h�- --><![CDATA[i�j]]></a>", ""},
+		{"error", InvalidCharError, `<a x="`, "xml writer: invalid character U+0001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			w := NewWriter(out)
+			w.SetOptions(WriterOptions{InvalidChars: tt.policy})
+			write(w)
+			if got := out.String(); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+			if err := w.Err(); (err == nil && tt.err != "") || (err != nil && err.Error() != tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	for _, s := range []string{"a\xffb", "a--b", "a-"} {
+		w := NewWriter(&bytes.Buffer{})
+		w.SetOptions(WriterOptions{InvalidChars: InvalidCharError})
+		w.Comment(s)
+		if w.Err() == nil {
+			t.Errorf("no error for comment %q", s)
+		}
+	}
+}
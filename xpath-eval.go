@@ -0,0 +1,472 @@
+package xg
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+func (e *xliteral) eval(c *xctx) (interface{}, error) {
+	return e.val, nil
+}
+
+func (e *xnumber) eval(c *xctx) (interface{}, error) {
+	return e.val, nil
+}
+
+func (e *xvariable) eval(c *xctx) (interface{}, error) {
+	v, ok := c.ev.vars[e.name]
+	if !ok {
+		return nil, fmt.Errorf("xpath: undefined variable $%s", e.name)
+	}
+	v, err := fromXVar(c.ev, v)
+	if err != nil {
+		return nil, fmt.Errorf("xpath: variable $%s: %w", e.name, err)
+	}
+	return v, nil
+}
+
+func (e *xnegate) eval(c *xctx) (interface{}, error) {
+	v, err := e.arg.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	return -toXNumber(v), nil
+}
+
+func (e *xbinary) eval(c *xctx) (interface{}, error) {
+	l, err := e.l.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "or":
+		if toXBool(l) {
+			return true, nil
+		}
+		r, err := e.r.eval(c)
+		if err != nil {
+			return nil, err
+		}
+		return toXBool(r), nil
+	case "and":
+		if !toXBool(l) {
+			return false, nil
+		}
+		r, err := e.r.eval(c)
+		if err != nil {
+			return nil, err
+		}
+		return toXBool(r), nil
+	}
+
+	r, err := e.r.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "=", "!=", "<", "<=", ">", ">=":
+		return compareX(e.op, l, r), nil
+	}
+	a, b := toXNumber(l), toXNumber(r)
+	switch e.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "div":
+		return a / b, nil
+	case "mod":
+		return math.Mod(a, b), nil
+	}
+	return nil, fmt.Errorf("xpath: unknown operator '%s'", e.op)
+}
+
+// compareX implements comparisons of arbitrary values, node-sets are
+// compared by the string values of their nodes
+func compareX(op string, l, r interface{}) bool {
+	ln, lset := l.([]xnode)
+	rn, rset := r.([]xnode)
+	switch {
+	case lset && rset:
+		for _, a := range ln {
+			sa := a.stringValue()
+			for _, b := range rn {
+				if compareAtoms(op, sa, b.stringValue()) {
+					return true
+				}
+			}
+		}
+		return false
+	case lset:
+		if b, ok := r.(bool); ok {
+			return compareAtoms(op, len(ln) > 0, b)
+		}
+		for _, a := range ln {
+			if compareAtoms(op, a.stringValue(), r) {
+				return true
+			}
+		}
+		return false
+	case rset:
+		if b, ok := l.(bool); ok {
+			return compareAtoms(op, b, len(rn) > 0)
+		}
+		for _, b := range rn {
+			if compareAtoms(op, l, b.stringValue()) {
+				return true
+			}
+		}
+		return false
+	}
+	return compareAtoms(op, l, r)
+}
+
+// compareAtoms compares strings, numbers and booleans
+func compareAtoms(op string, l, r interface{}) bool {
+	if op == "=" || op == "!=" {
+		var eq bool
+		_, lb := l.(bool)
+		_, rb := r.(bool)
+		_, lf := l.(float64)
+		_, rf := r.(float64)
+		switch {
+		case lb || rb:
+			eq = toXBool(l) == toXBool(r)
+		case lf || rf:
+			eq = toXNumber(l) == toXNumber(r)
+		default:
+			eq = toXString(l) == toXString(r)
+		}
+		if op == "=" {
+			return eq
+		}
+		return !eq
+	}
+	a, b := toXNumber(l), toXNumber(r)
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+func (e *xunion) eval(c *xctx) (interface{}, error) {
+	l, err := evalNodes(c, e.l, "|")
+	if err != nil {
+		return nil, err
+	}
+	r, err := evalNodes(c, e.r, "|")
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]xnode, 0, len(l)+len(r))
+	nodes = append(append(nodes, l...), r...)
+	return c.ev.sortNodes(nodes), nil
+}
+
+// evalNodes evaluates an expression that must produce a node-set
+func evalNodes(c *xctx, e xexpr, context string) ([]xnode, error) {
+	v, err := e.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := v.([]xnode)
+	if !ok {
+		return nil, fmt.Errorf("xpath: %s expects a node-set", context)
+	}
+	return nodes, nil
+}
+
+func (e *xcall) eval(c *xctx) (interface{}, error) {
+	args := make([]interface{}, len(e.args))
+	for i, a := range e.args {
+		v, err := a.eval(c)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return e.fn.call(c, args)
+}
+
+func (e *xfilter) eval(c *xctx) (interface{}, error) {
+	nodes, err := evalNodes(c, e.primary, "predicate")
+	if err != nil {
+		return nil, err
+	}
+	return filterNodes(c.ev, nodes, e.preds)
+}
+
+// filterNodes applies predicates to nodes listed in the proximity order
+func filterNodes(ev *xeval, nodes []xnode, preds []xexpr) ([]xnode, error) {
+	for _, pred := range preds {
+		var kept []xnode
+		for i, n := range nodes {
+			v, err := pred.eval(&xctx{ev: ev, node: n, pos: i + 1, size: len(nodes)})
+			if err != nil {
+				return nil, err
+			}
+			if f, ok := v.(float64); ok {
+				if f == float64(i+1) {
+					kept = append(kept, n)
+				}
+			} else if toXBool(v) {
+				kept = append(kept, n)
+			}
+		}
+		nodes = kept
+	}
+	return nodes, nil
+}
+
+func (e *xpath) eval(c *xctx) (interface{}, error) {
+	var nodes []xnode
+	switch {
+	case e.filter != nil:
+		var err error
+		nodes, err = evalNodes(c, e.filter, "'/'")
+		if err != nil {
+			return nil, err
+		}
+	case e.absolute:
+		root := c.node.n
+		for root.Parent != nil {
+			root = root.Parent
+		}
+		nodes = []xnode{{n: root, attr: xself}}
+	default:
+		nodes = []xnode{c.node}
+	}
+
+	for _, step := range e.steps {
+		var next []xnode
+		for _, n := range nodes {
+			selected := step.test.filter(step.axis, axisNodes(step.axis, n))
+			selected, err := filterNodes(c.ev, selected, step.preds)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, selected...)
+		}
+		if len(nodes) > 1 || step.axis.reverse() {
+			next = c.ev.sortNodes(next)
+		}
+		nodes = next
+	}
+	if nodes == nil {
+		nodes = []xnode{}
+	}
+	return nodes, nil
+}
+
+// inTree reports nodes that are visible in the XPath data model
+func inTree(n *Node) bool {
+	return n.Kind != DeclNode && n.Kind != DocTypeNode
+}
+
+func appendChildren(dst []xnode, n *Node) []xnode {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if inTree(c) {
+			dst = append(dst, xnode{n: c, attr: xself})
+		}
+	}
+	return dst
+}
+
+func appendDescendants(dst []xnode, n *Node) []xnode {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if inTree(c) {
+			dst = append(dst, xnode{n: c, attr: xself})
+			dst = appendDescendants(dst, c)
+		}
+	}
+	return dst
+}
+
+// appendReversed appends n and its descendants in reverse document order
+func appendReversed(dst []xnode, n *Node) []xnode {
+	for c := n.LastChild; c != nil; c = c.PrevSibling {
+		if inTree(c) {
+			dst = appendReversed(dst, c)
+		}
+	}
+	return append(dst, xnode{n: n, attr: xself})
+}
+
+// axisNodes lists the nodes of the axis in the proximity order
+func axisNodes(axis xaxis, x xnode) []xnode {
+	n := x.n
+	owned := x.attr != xself // attribute or namespace node
+	var ret []xnode
+	switch axis {
+	case axisSelf:
+		ret = append(ret, x)
+	case axisChild:
+		if !owned {
+			ret = appendChildren(ret, n)
+		}
+	case axisDescendant:
+		if !owned {
+			ret = appendDescendants(ret, n)
+		}
+	case axisDescendantOrSelf:
+		ret = append(ret, x)
+		if !owned {
+			ret = appendDescendants(ret, n)
+		}
+	case axisParent:
+		if owned {
+			ret = append(ret, xnode{n: n, attr: xself})
+		} else if n.Parent != nil {
+			ret = append(ret, xnode{n: n.Parent, attr: xself})
+		}
+	case axisAncestor, axisAncestorOrSelf:
+		if axis == axisAncestorOrSelf {
+			ret = append(ret, x)
+		}
+		if owned {
+			ret = append(ret, xnode{n: n, attr: xself})
+		}
+		for p := n.Parent; p != nil; p = p.Parent {
+			ret = append(ret, xnode{n: p, attr: xself})
+		}
+	case axisFollowingSibling:
+		if !owned {
+			for s := n.NextSibling; s != nil; s = s.NextSibling {
+				if inTree(s) {
+					ret = append(ret, xnode{n: s, attr: xself})
+				}
+			}
+		}
+	case axisPrecedingSibling:
+		if !owned {
+			for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+				if inTree(s) {
+					ret = append(ret, xnode{n: s, attr: xself})
+				}
+			}
+		}
+	case axisFollowing:
+		if owned {
+			ret = appendDescendants(ret, n)
+		}
+		for a := n; a != nil; a = a.Parent {
+			for s := a.NextSibling; s != nil; s = s.NextSibling {
+				if inTree(s) {
+					ret = append(ret, xnode{n: s, attr: xself})
+					ret = appendDescendants(ret, s)
+				}
+			}
+		}
+	case axisPreceding:
+		for a := n; a != nil; a = a.Parent {
+			for s := a.PrevSibling; s != nil; s = s.PrevSibling {
+				if inTree(s) {
+					ret = appendReversed(ret, s)
+				}
+			}
+		}
+	case axisAttribute:
+		if !owned && n.Kind == ElementNode {
+			for i, a := range n.Attrs {
+				if a.Name == "xmlns" || strings.HasPrefix(string(a.Name), "xmlns:") {
+					continue
+				}
+				ret = append(ret, xnode{n: n, attr: i})
+			}
+		}
+	case axisNamespace:
+		if !owned && n.Kind == ElementNode {
+			for _, prefix := range inScopePrefixes(n) {
+				ret = append(ret, xnode{n: n, attr: xnamespace, prefix: prefix})
+			}
+		}
+	}
+	return ret
+}
+
+// inScopePrefixes lists the prefixes of namespaces declared in the scope of
+// the element, the default namespace has an empty prefix
+func inScopePrefixes(n *Node) []string {
+	seen := map[string]bool{"xml": true}
+	prefixes := []string{"xml"}
+	for e := n; e != nil; e = e.Parent {
+		if e.Kind != ElementNode {
+			continue
+		}
+		for _, a := range e.Attrs {
+			var prefix string
+			switch {
+			case a.Name == "xmlns":
+			case strings.HasPrefix(string(a.Name), "xmlns:"):
+				prefix = string(a.Name[6:])
+			default:
+				continue
+			}
+			if seen[prefix] {
+				continue
+			}
+			seen[prefix] = true
+			if a.Value != "" {
+				prefixes = append(prefixes, prefix)
+			}
+		}
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// filter keeps the nodes that pass the node test
+func (t *xnodeTest) filter(axis xaxis, nodes []xnode) []xnode {
+	if t.kind == "node" {
+		return nodes
+	}
+	ret := nodes[:0]
+	for _, n := range nodes {
+		if t.match(axis, n) {
+			ret = append(ret, n)
+		}
+	}
+	return ret
+}
+
+func (t *xnodeTest) match(axis xaxis, x xnode) bool {
+	k := x.kind()
+	switch t.kind {
+	case "text":
+		return k == TextNode
+	case "comment":
+		return k == CommentNode
+	case "processing-instruction":
+		return k == PINode && (t.local == "" || string(x.qname()) == t.local)
+	}
+
+	// name tests select the principal node type of the axis
+	principal := ElementNode
+	switch axis {
+	case axisAttribute:
+		principal = AttributeNode
+	case axisNamespace:
+		principal = NamespaceNode
+	}
+	if k != principal {
+		return false
+	}
+	if t.any && !t.hasURI {
+		return true
+	}
+	if x.namespaceURI() != t.uri {
+		return false
+	}
+	return t.any || x.localName() == t.local
+}
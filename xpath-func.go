@@ -0,0 +1,277 @@
+package xg
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// xfunc is a function of the core library, arguments are evaluated before
+// the call
+type xfunc struct {
+	name    string
+	minArgs int
+	maxArgs int // -1 for unlimited
+	call    func(c *xctx, args []interface{}) (interface{}, error)
+}
+
+var xfunctions map[string]*xfunc
+
+func init() {
+	xfunctions = map[string]*xfunc{}
+	for _, f := range []*xfunc{
+		// node-set functions
+		{"last", 0, 0, func(c *xctx, args []interface{}) (interface{}, error) {
+			return float64(c.size), nil
+		}},
+		{"position", 0, 0, func(c *xctx, args []interface{}) (interface{}, error) {
+			return float64(c.pos), nil
+		}},
+		{"count", 1, 1, func(c *xctx, args []interface{}) (interface{}, error) {
+			nodes, err := nodesArg("count", args[0])
+			return float64(len(nodes)), err
+		}},
+		{"id", 1, 1, xfnID},
+		{"local-name", 0, 1, func(c *xctx, args []interface{}) (interface{}, error) {
+			n, ok, err := optNodeArg(c, "local-name", args)
+			if !ok {
+				return "", err
+			}
+			return n.localName(), nil
+		}},
+		{"namespace-uri", 0, 1, func(c *xctx, args []interface{}) (interface{}, error) {
+			n, ok, err := optNodeArg(c, "namespace-uri", args)
+			if !ok {
+				return "", err
+			}
+			return n.namespaceURI(), nil
+		}},
+		{"name", 0, 1, func(c *xctx, args []interface{}) (interface{}, error) {
+			n, ok, err := optNodeArg(c, "name", args)
+			if !ok {
+				return "", err
+			}
+			return string(n.qname()), nil
+		}},
+
+		// string functions
+		{"string", 0, 1, func(c *xctx, args []interface{}) (interface{}, error) {
+			return toXString(optArg(c, args)), nil
+		}},
+		{"concat", 2, -1, func(c *xctx, args []interface{}) (interface{}, error) {
+			sb := strings.Builder{}
+			for _, a := range args {
+				sb.WriteString(toXString(a))
+			}
+			return sb.String(), nil
+		}},
+		{"starts-with", 2, 2, func(c *xctx, args []interface{}) (interface{}, error) {
+			return strings.HasPrefix(toXString(args[0]), toXString(args[1])), nil
+		}},
+		{"contains", 2, 2, func(c *xctx, args []interface{}) (interface{}, error) {
+			return strings.Contains(toXString(args[0]), toXString(args[1])), nil
+		}},
+		{"substring-before", 2, 2, func(c *xctx, args []interface{}) (interface{}, error) {
+			s, sep := toXString(args[0]), toXString(args[1])
+			if i := strings.Index(s, sep); i >= 0 {
+				return s[:i], nil
+			}
+			return "", nil
+		}},
+		{"substring-after", 2, 2, func(c *xctx, args []interface{}) (interface{}, error) {
+			s, sep := toXString(args[0]), toXString(args[1])
+			if i := strings.Index(s, sep); i >= 0 {
+				return s[i+len(sep):], nil
+			}
+			return "", nil
+		}},
+		{"substring", 2, 3, xfnSubstring},
+		{"string-length", 0, 1, func(c *xctx, args []interface{}) (interface{}, error) {
+			return float64(utf8.RuneCountInString(toXString(optArg(c, args)))), nil
+		}},
+		{"normalize-space", 0, 1, func(c *xctx, args []interface{}) (interface{}, error) {
+			return strings.Join(strings.FieldsFunc(toXString(optArg(c, args)), func(r rune) bool {
+				return r == ' ' || r == '\t' || r == '\r' || r == '\n'
+			}), " "), nil
+		}},
+		{"translate", 3, 3, xfnTranslate},
+
+		// boolean functions
+		{"boolean", 1, 1, func(c *xctx, args []interface{}) (interface{}, error) {
+			return toXBool(args[0]), nil
+		}},
+		{"not", 1, 1, func(c *xctx, args []interface{}) (interface{}, error) {
+			return !toXBool(args[0]), nil
+		}},
+		{"true", 0, 0, func(c *xctx, args []interface{}) (interface{}, error) {
+			return true, nil
+		}},
+		{"false", 0, 0, func(c *xctx, args []interface{}) (interface{}, error) {
+			return false, nil
+		}},
+		{"lang", 1, 1, xfnLang},
+
+		// number functions
+		{"number", 0, 1, func(c *xctx, args []interface{}) (interface{}, error) {
+			return toXNumber(optArg(c, args)), nil
+		}},
+		{"sum", 1, 1, func(c *xctx, args []interface{}) (interface{}, error) {
+			nodes, err := nodesArg("sum", args[0])
+			sum := 0.0
+			for _, n := range nodes {
+				sum += parseXNumber(n.stringValue())
+			}
+			return sum, err
+		}},
+		{"floor", 1, 1, func(c *xctx, args []interface{}) (interface{}, error) {
+			return math.Floor(toXNumber(args[0])), nil
+		}},
+		{"ceiling", 1, 1, func(c *xctx, args []interface{}) (interface{}, error) {
+			return math.Ceil(toXNumber(args[0])), nil
+		}},
+		{"round", 1, 1, func(c *xctx, args []interface{}) (interface{}, error) {
+			return roundX(toXNumber(args[0])), nil
+		}},
+	} {
+		xfunctions[f.name] = f
+	}
+}
+
+func nodesArg(fn string, v interface{}) ([]xnode, error) {
+	nodes, ok := v.([]xnode)
+	if !ok {
+		return nil, fmt.Errorf("xpath: %s() expects a node-set argument", fn)
+	}
+	return nodes, nil
+}
+
+// optArg returns the only argument, or the context node as a node-set
+func optArg(c *xctx, args []interface{}) interface{} {
+	if len(args) > 0 {
+		return args[0]
+	}
+	return []xnode{c.node}
+}
+
+// optNodeArg returns the first node of the node-set argument, or the context
+// node when the argument is omitted
+func optNodeArg(c *xctx, fn string, args []interface{}) (xnode, bool, error) {
+	nodes, err := nodesArg(fn, optArg(c, args))
+	if err != nil || len(nodes) == 0 {
+		return xnode{}, false, err
+	}
+	if len(args) > 0 {
+		nodes = c.ev.sortNodes(nodes)
+	}
+	return nodes[0], true, nil
+}
+
+// roundX rounds half up, preserving negative zero
+func roundX(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) || f == 0 {
+		return f
+	}
+	if f < 0 && f >= -0.5 {
+		return math.Copysign(0, -1)
+	}
+	return math.Floor(f + 0.5)
+}
+
+func xfnSubstring(c *xctx, args []interface{}) (interface{}, error) {
+	s := []rune(toXString(args[0]))
+	start := roundX(toXNumber(args[1]))
+	end := math.Inf(1)
+	if len(args) > 2 {
+		end = start + roundX(toXNumber(args[2]))
+	}
+	sb := strings.Builder{}
+	for i, r := range s {
+		p := float64(i + 1)
+		if p >= start && p < end {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String(), nil
+}
+
+func xfnTranslate(c *xctx, args []interface{}) (interface{}, error) {
+	s := toXString(args[0])
+	from := []rune(toXString(args[1]))
+	to := []rune(toXString(args[2]))
+	m := map[rune]int{}
+	for i, r := range from {
+		if _, ok := m[r]; !ok {
+			m[r] = i
+		}
+	}
+	sb := strings.Builder{}
+	for _, r := range s {
+		i, ok := m[r]
+		switch {
+		case !ok:
+			sb.WriteRune(r)
+		case i < len(to):
+			sb.WriteRune(to[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+// xfnID selects elements by the values of their id or xml:id attributes
+func xfnID(c *xctx, args []interface{}) (interface{}, error) {
+	var ids []string
+	if nodes, ok := args[0].([]xnode); ok {
+		for _, n := range nodes {
+			ids = append(ids, strings.Fields(n.stringValue())...)
+		}
+	} else {
+		ids = strings.Fields(toXString(args[0]))
+	}
+	want := map[string]bool{}
+	for _, id := range ids {
+		want[id] = true
+	}
+
+	root := c.node.n
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	ret := []xnode{}
+	if len(want) == 0 {
+		return ret, nil
+	}
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		for e := n.FirstChild; e != nil; e = e.NextSibling {
+			if e.Kind != ElementNode {
+				continue
+			}
+			for _, a := range e.Attrs {
+				if (a.Name == "id" || a.Name == "xml:id") && want[a.Value] {
+					ret = append(ret, xnode{n: e, attr: xself})
+					delete(want, a.Value)
+					break
+				}
+			}
+			walk(e)
+		}
+	}
+	walk(root)
+	return ret, nil
+}
+
+// xfnLang tests the xml:lang attribute in scope of the context node
+func xfnLang(c *xctx, args []interface{}) (interface{}, error) {
+	want := strings.ToLower(toXString(args[0]))
+	for e := c.node.n; e != nil; e = e.Parent {
+		if e.Kind != ElementNode {
+			continue
+		}
+		if lang, ok := e.Attr("xml:lang"); ok {
+			lang = strings.ToLower(lang)
+			return lang == want || strings.HasPrefix(lang, want+"-"), nil
+		}
+	}
+	return false, nil
+}
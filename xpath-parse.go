@@ -0,0 +1,694 @@
+package xg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type xtokKind int
+
+const (
+	xtEOF = xtokKind(iota)
+	xtLParen
+	xtRParen
+	xtLBracket
+	xtRBracket
+	xtDot
+	xtDotDot
+	xtAt
+	xtComma
+	xtColonColon
+	xtNameTest     // *, prefix:*, or qname
+	xtNodeType     // comment, text, processing-instruction, node
+	xtOperator     // and or mod div * / // | + - = != < <= > >=
+	xtFunctionName // qname
+	xtAxisName     // axis name
+	xtLiteral      // quoted string
+	xtNumber       // number
+	xtVariable     // $qname
+)
+
+type xtoken struct {
+	kind xtokKind
+	val  string
+	pos  int
+}
+
+func xpathSyntaxError(src string, pos int, msg string) error {
+	return fmt.Errorf("xpath: %s at offset %d in %q", msg, pos, src)
+}
+
+func isNCNameStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || (r >= 0x80 && !unicode.IsSpace(r) && !unicode.IsPunct(r))
+}
+
+func isNCNameChar(r rune) bool {
+	return isNCNameStart(r) || unicode.IsDigit(r) || r == '-' || r == '.' || unicode.Is(unicode.Mn, r)
+}
+
+func scanNCName(s string, i int) int {
+	r, n := utf8.DecodeRuneInString(s[i:])
+	if n == 0 || !isNCNameStart(r) {
+		return i
+	}
+	i += n
+	for i < len(s) {
+		r, n = utf8.DecodeRuneInString(s[i:])
+		if !isNCNameChar(r) {
+			break
+		}
+		i += n
+	}
+	return i
+}
+
+func isXPathWhite(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func lexXPath(src string) ([]xtoken, error) {
+	var toks []xtoken
+	i := 0
+
+	// operatorExpected implements the disambiguation rule for '*' and
+	// operator names
+	operatorExpected := func() bool {
+		if len(toks) == 0 {
+			return false
+		}
+		switch toks[len(toks)-1].kind {
+		case xtAt, xtColonColon, xtLParen, xtLBracket, xtComma, xtOperator:
+			return false
+		}
+		return true
+	}
+	nextNonWhite := func(i int) int {
+		for i < len(src) && isXPathWhite(src[i]) {
+			i++
+		}
+		return i
+	}
+	add := func(kind xtokKind, val string, pos int) {
+		toks = append(toks, xtoken{kind: kind, val: val, pos: pos})
+	}
+
+	for {
+		i = nextNonWhite(i)
+		if i >= len(src) {
+			add(xtEOF, "", i)
+			return toks, nil
+		}
+		start := i
+		c := src[i]
+		switch {
+		case c == '(':
+			add(xtLParen, "(", i)
+			i++
+		case c == ')':
+			add(xtRParen, ")", i)
+			i++
+		case c == '[':
+			add(xtLBracket, "[", i)
+			i++
+		case c == ']':
+			add(xtRBracket, "]", i)
+			i++
+		case c == ',':
+			add(xtComma, ",", i)
+			i++
+		case c == '@':
+			add(xtAt, "@", i)
+			i++
+		case c == '|' || c == '+' || c == '-' || c == '=':
+			add(xtOperator, src[i:i+1], i)
+			i++
+		case c == '!':
+			if !strings.HasPrefix(src[i:], "!=") {
+				return nil, xpathSyntaxError(src, i, "unexpected '!'")
+			}
+			add(xtOperator, "!=", i)
+			i += 2
+		case c == '<' || c == '>':
+			if strings.HasPrefix(src[i+1:], "=") {
+				add(xtOperator, src[i:i+2], i)
+				i += 2
+			} else {
+				add(xtOperator, src[i:i+1], i)
+				i++
+			}
+		case c == '/':
+			if strings.HasPrefix(src[i:], "//") {
+				add(xtOperator, "//", i)
+				i += 2
+			} else {
+				add(xtOperator, "/", i)
+				i++
+			}
+		case c == ':':
+			if !strings.HasPrefix(src[i:], "::") {
+				return nil, xpathSyntaxError(src, i, "unexpected ':'")
+			}
+			add(xtColonColon, "::", i)
+			i += 2
+		case c == '"' || c == '\'':
+			e := strings.IndexByte(src[i+1:], c)
+			if e < 0 {
+				return nil, xpathSyntaxError(src, i, "unterminated literal")
+			}
+			add(xtLiteral, src[i+1:i+1+e], i)
+			i += e + 2
+		case c == '.' && strings.HasPrefix(src[i:], ".."):
+			add(xtDotDot, "..", i)
+			i += 2
+		case c == '.' && (i+1 >= len(src) || !isDecDigit(src[i+1])):
+			add(xtDot, ".", i)
+			i++
+		case c == '.' || isDecDigit(c):
+			for i < len(src) && isDecDigit(src[i]) {
+				i++
+			}
+			if i < len(src) && src[i] == '.' {
+				i++
+				for i < len(src) && isDecDigit(src[i]) {
+					i++
+				}
+			}
+			add(xtNumber, src[start:i], start)
+		case c == '$':
+			e := scanNCName(src, i+1)
+			if e == i+1 {
+				return nil, xpathSyntaxError(src, i, "variable name expected")
+			}
+			if e < len(src) && src[e] == ':' && !strings.HasPrefix(src[e:], "::") {
+				if e2 := scanNCName(src, e+1); e2 > e+1 {
+					e = e2
+				}
+			}
+			add(xtVariable, src[i+1:e], i)
+			i = e
+		case c == '*':
+			if operatorExpected() {
+				add(xtOperator, "*", i)
+			} else {
+				add(xtNameTest, "*", i)
+			}
+			i++
+		default:
+			e := scanNCName(src, i)
+			if e == i {
+				return nil, xpathSyntaxError(src, i, fmt.Sprintf("unexpected '%c'", c))
+			}
+			name := src[i:e]
+			i = e
+			if operatorExpected() {
+				switch name {
+				case "and", "or", "mod", "div":
+					add(xtOperator, name, start)
+					continue
+				}
+				return nil, xpathSyntaxError(src, start, "operator expected")
+			}
+			// qualified names
+			if i+1 < len(src) && src[i] == ':' && src[i+1] != ':' {
+				if src[i+1] == '*' {
+					add(xtNameTest, src[start:i+2], start)
+					i += 2
+					continue
+				}
+				e := scanNCName(src, i+1)
+				if e == i+1 {
+					return nil, xpathSyntaxError(src, i, "local name expected")
+				}
+				i = e
+				name = src[start:i]
+			}
+			j := nextNonWhite(i)
+			switch {
+			case strings.HasPrefix(src[j:], "("):
+				switch name {
+				case "comment", "text", "processing-instruction", "node":
+					add(xtNodeType, name, start)
+				default:
+					add(xtFunctionName, name, start)
+				}
+			case strings.HasPrefix(src[j:], "::"):
+				add(xtAxisName, name, start)
+			default:
+				add(xtNameTest, name, start)
+			}
+		}
+	}
+}
+
+type xaxis int
+
+const (
+	axisAncestor = xaxis(iota)
+	axisAncestorOrSelf
+	axisAttribute
+	axisChild
+	axisDescendant
+	axisDescendantOrSelf
+	axisFollowing
+	axisFollowingSibling
+	axisNamespace
+	axisParent
+	axisPreceding
+	axisPrecedingSibling
+	axisSelf
+)
+
+var xaxisNames = map[string]xaxis{
+	"ancestor":           axisAncestor,
+	"ancestor-or-self":   axisAncestorOrSelf,
+	"attribute":          axisAttribute,
+	"child":              axisChild,
+	"descendant":         axisDescendant,
+	"descendant-or-self": axisDescendantOrSelf,
+	"following":          axisFollowing,
+	"following-sibling":  axisFollowingSibling,
+	"namespace":          axisNamespace,
+	"parent":             axisParent,
+	"preceding":          axisPreceding,
+	"preceding-sibling":  axisPrecedingSibling,
+	"self":               axisSelf,
+}
+
+func (a xaxis) reverse() bool {
+	switch a {
+	case axisAncestor, axisAncestorOrSelf, axisPreceding, axisPrecedingSibling:
+		return true
+	}
+	return false
+}
+
+// xexpr is a compiled expression node
+type xexpr interface {
+	eval(c *xctx) (interface{}, error)
+}
+
+type (
+	xliteral  struct{ val string }
+	xnumber   struct{ val float64 }
+	xvariable struct{ name string }
+	xnegate   struct{ arg xexpr }
+	xbinary   struct {
+		op   string
+		l, r xexpr
+	}
+	xunion struct{ l, r xexpr }
+	xcall  struct {
+		fn   *xfunc
+		args []xexpr
+	}
+	xfilter struct {
+		primary xexpr
+		preds   []xexpr
+	}
+	xpath struct {
+		filter   xexpr // nil for location paths
+		absolute bool
+		steps    []*xstep
+	}
+	xstep struct {
+		axis  xaxis
+		test  xnodeTest
+		preds []xexpr
+	}
+)
+
+// xnodeTest is a name test or a node type test
+type xnodeTest struct {
+	kind   string // "name", "node", "text", "comment", "processing-instruction"
+	any    bool   // * or prefix:*
+	uri    string
+	local  string // name test local name, or processing-instruction literal
+	hasURI bool
+}
+
+type xparser struct {
+	src        string
+	toks       []xtoken
+	i          int
+	namespaces map[string]string
+}
+
+func (p *xparser) peek() xtoken {
+	return p.toks[p.i]
+}
+
+func (p *xparser) next() xtoken {
+	t := p.toks[p.i]
+	if t.kind != xtEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *xparser) isOp(vals ...string) bool {
+	t := p.peek()
+	if t.kind != xtOperator {
+		return false
+	}
+	for _, v := range vals {
+		if t.val == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *xparser) fail(msg string) error {
+	return xpathSyntaxError(p.src, p.peek().pos, msg)
+}
+
+func (p *xparser) expect(kind xtokKind, what string) error {
+	if p.peek().kind != kind {
+		return p.fail(what + " expected")
+	}
+	p.next()
+	return nil
+}
+
+func (p *xparser) parse() (xexpr, error) {
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != xtEOF {
+		return nil, p.fail("unexpected token '" + p.peek().val + "'")
+	}
+	return e, nil
+}
+
+func (p *xparser) parseBinary(sub func() (xexpr, error), ops ...string) (xexpr, error) {
+	l, err := sub()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp(ops...) {
+		op := p.next().val
+		r, err := sub()
+		if err != nil {
+			return nil, err
+		}
+		l = &xbinary{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *xparser) parseOr() (xexpr, error) {
+	return p.parseBinary(p.parseAnd, "or")
+}
+
+func (p *xparser) parseAnd() (xexpr, error) {
+	return p.parseBinary(p.parseEquality, "and")
+}
+
+func (p *xparser) parseEquality() (xexpr, error) {
+	return p.parseBinary(p.parseRelational, "=", "!=")
+}
+
+func (p *xparser) parseRelational() (xexpr, error) {
+	return p.parseBinary(p.parseAdditive, "<", "<=", ">", ">=")
+}
+
+func (p *xparser) parseAdditive() (xexpr, error) {
+	return p.parseBinary(p.parseMultiplicative, "+", "-")
+}
+
+func (p *xparser) parseMultiplicative() (xexpr, error) {
+	return p.parseBinary(p.parseUnary, "*", "div", "mod")
+}
+
+func (p *xparser) parseUnary() (xexpr, error) {
+	if p.isOp("-") {
+		p.next()
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &xnegate{arg: e}, nil
+	}
+	return p.parseUnion()
+}
+
+func (p *xparser) parseUnion() (xexpr, error) {
+	l, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("|") {
+		p.next()
+		r, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		l = &xunion{l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *xparser) parsePath() (xexpr, error) {
+	switch p.peek().kind {
+	case xtVariable, xtLParen, xtLiteral, xtNumber, xtFunctionName:
+		primary, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		preds, err := p.parsePredicates()
+		if err != nil {
+			return nil, err
+		}
+		var filter xexpr = primary
+		if len(preds) > 0 {
+			filter = &xfilter{primary: primary, preds: preds}
+		}
+		if !p.isOp("/", "//") {
+			return filter, nil
+		}
+		path := &xpath{filter: filter}
+		return path, p.parseRelative(path)
+	}
+
+	path := &xpath{}
+	if p.isOp("/") {
+		path.absolute = true
+		p.next()
+		if !p.atStep() {
+			return path, nil
+		}
+	} else if p.isOp("//") {
+		path.absolute = true
+		p.next()
+		path.steps = append(path.steps, &xstep{axis: axisDescendantOrSelf, test: xnodeTest{kind: "node"}})
+	}
+	return path, p.parseRelative(path)
+}
+
+func (p *xparser) atStep() bool {
+	switch p.peek().kind {
+	case xtNameTest, xtNodeType, xtAxisName, xtAt, xtDot, xtDotDot:
+		return true
+	}
+	return false
+}
+
+// parseRelative parses a relative location path, the filter expression of
+// the path is followed by a '/' or '//' separator
+func (p *xparser) parseRelative(path *xpath) error {
+	if path.filter != nil {
+		if p.next().val == "//" {
+			path.steps = append(path.steps, &xstep{axis: axisDescendantOrSelf, test: xnodeTest{kind: "node"}})
+		}
+	}
+	for {
+		step, err := p.parseStep()
+		if err != nil {
+			return err
+		}
+		path.steps = append(path.steps, step)
+		if p.isOp("/") {
+			p.next()
+		} else if p.isOp("//") {
+			p.next()
+			path.steps = append(path.steps, &xstep{axis: axisDescendantOrSelf, test: xnodeTest{kind: "node"}})
+		} else {
+			break
+		}
+	}
+	path.steps = optimizeSteps(path.steps)
+	return nil
+}
+
+// optimizeSteps replaces descendant-or-self::node()/child::x with an
+// equivalent descendant::x when the child step has no predicates
+func optimizeSteps(steps []*xstep) []*xstep {
+	ret := steps[:0]
+	for i := 0; i < len(steps); i++ {
+		s := steps[i]
+		if i+1 < len(steps) && s.axis == axisDescendantOrSelf && s.test.kind == "node" && len(s.preds) == 0 {
+			n := steps[i+1]
+			if n.axis == axisChild && len(n.preds) == 0 {
+				ret = append(ret, &xstep{axis: axisDescendant, test: n.test})
+				i++
+				continue
+			}
+		}
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+func (p *xparser) parseStep() (*xstep, error) {
+	switch p.peek().kind {
+	case xtDot:
+		p.next()
+		return &xstep{axis: axisSelf, test: xnodeTest{kind: "node"}}, nil
+	case xtDotDot:
+		p.next()
+		return &xstep{axis: axisParent, test: xnodeTest{kind: "node"}}, nil
+	}
+
+	step := &xstep{axis: axisChild}
+	switch p.peek().kind {
+	case xtAt:
+		p.next()
+		step.axis = axisAttribute
+	case xtAxisName:
+		t := p.next()
+		axis, ok := xaxisNames[t.val]
+		if !ok {
+			return nil, xpathSyntaxError(p.src, t.pos, "unknown axis '"+t.val+"'")
+		}
+		step.axis = axis
+		if err := p.expect(xtColonColon, "'::'"); err != nil {
+			return nil, err
+		}
+	}
+
+	t := p.next()
+	switch t.kind {
+	case xtNameTest:
+		test, err := p.nameTest(t)
+		if err != nil {
+			return nil, err
+		}
+		step.test = test
+	case xtNodeType:
+		step.test.kind = t.val
+		if err := p.expect(xtLParen, "'('"); err != nil {
+			return nil, err
+		}
+		if t.val == "processing-instruction" && p.peek().kind == xtLiteral {
+			step.test.local = p.next().val
+		}
+		if err := p.expect(xtRParen, "')'"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, xpathSyntaxError(p.src, t.pos, "node test expected")
+	}
+
+	preds, err := p.parsePredicates()
+	if err != nil {
+		return nil, err
+	}
+	step.preds = preds
+	return step, nil
+}
+
+func (p *xparser) nameTest(t xtoken) (xnodeTest, error) {
+	test := xnodeTest{kind: "name"}
+	if t.val == "*" {
+		test.any = true
+		return test, nil
+	}
+	prefix, local := splitQName(NameString(t.val))
+	if prefix != "" {
+		uri, ok := p.namespaces[prefix]
+		if !ok && prefix == "xml" {
+			uri, ok = xmlNamespaceURI, true
+		}
+		if !ok {
+			return test, xpathSyntaxError(p.src, t.pos, "unbound namespace prefix '"+prefix+"'")
+		}
+		test.uri = uri
+	}
+	test.hasURI = true
+	if local == "*" {
+		test.any = true
+	} else {
+		test.local = local
+	}
+	return test, nil
+}
+
+func (p *xparser) parsePredicates() ([]xexpr, error) {
+	var preds []xexpr
+	for p.peek().kind == xtLBracket {
+		p.next()
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(xtRBracket, "']'"); err != nil {
+			return nil, err
+		}
+		preds = append(preds, e)
+	}
+	return preds, nil
+}
+
+func (p *xparser) parsePrimary() (xexpr, error) {
+	t := p.next()
+	switch t.kind {
+	case xtVariable:
+		return &xvariable{name: t.val}, nil
+	case xtLiteral:
+		return &xliteral{val: t.val}, nil
+	case xtNumber:
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, xpathSyntaxError(p.src, t.pos, "invalid number")
+		}
+		return &xnumber{val: f}, nil
+	case xtLParen:
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(xtRParen, "')'")
+	case xtFunctionName:
+		fn, ok := xfunctions[t.val]
+		if !ok {
+			return nil, xpathSyntaxError(p.src, t.pos, "unknown function '"+t.val+"'")
+		}
+		p.next() // '('
+		call := &xcall{fn: fn}
+		if p.peek().kind != xtRParen {
+			for {
+				arg, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				call.args = append(call.args, arg)
+				if p.peek().kind != xtComma {
+					break
+				}
+				p.next()
+			}
+		}
+		if err := p.expect(xtRParen, "')'"); err != nil {
+			return nil, err
+		}
+		if len(call.args) < fn.minArgs || (fn.maxArgs >= 0 && len(call.args) > fn.maxArgs) {
+			return nil, xpathSyntaxError(p.src, t.pos, "wrong number of arguments for '"+t.val+"'")
+		}
+		return call, nil
+	}
+	return nil, xpathSyntaxError(p.src, t.pos, "expression expected")
+}
@@ -0,0 +1,433 @@
+package xg
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// XPath is a compiled XPath 1.0 expression
+//
+// A compiled expression is immutable and may be evaluated concurrently
+// against shared trees, as long as the trees are not modified.
+type XPath struct {
+	src  string
+	root xexpr
+}
+
+// CompileXPath compiles an XPath 1.0 expression. Namespace prefixes used in
+// name tests are resolved with the namespaces map (prefix to URI). The "xml"
+// prefix is always bound.
+func CompileXPath(expr string, namespaces map[string]string) (*XPath, error) {
+	toks, err := lexXPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &xparser{src: expr, toks: toks, namespaces: namespaces}
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &XPath{src: expr, root: root}, nil
+}
+
+// MustCompileXPath is like CompileXPath, but panics on errors
+func MustCompileXPath(expr string, namespaces map[string]string) *XPath {
+	x, err := CompileXPath(expr, namespaces)
+	if err != nil {
+		panic(err)
+	}
+	return x
+}
+
+func (x *XPath) String() string {
+	return x.src
+}
+
+// Evaluate evaluates the expression with node as the context node. The result
+// is one of []*Node, string, float64 or bool.
+//
+// Attribute and namespace nodes are returned as detached nodes of
+// AttributeNode and NamespaceNode kinds, their Parent refers to the owner
+// element.
+func (x *XPath) Evaluate(node *Node) (interface{}, error) {
+	return x.EvaluateVars(node, nil)
+}
+
+// EvaluateVars evaluates the expression with variable bindings. Supported
+// variable values are string, bool, numbers, *Node, and []*Node.
+func (x *XPath) EvaluateVars(node *Node, vars map[string]interface{}) (interface{}, error) {
+	ev := &xeval{vars: vars}
+	v, err := x.root.eval(&xctx{ev: ev, node: fromNode(node), pos: 1, size: 1})
+	if err != nil {
+		return nil, err
+	}
+	if nodes, ok := v.([]xnode); ok {
+		ret := make([]*Node, len(nodes))
+		for i, n := range nodes {
+			ret[i] = n.toNode()
+		}
+		return ret, nil
+	}
+	return v, nil
+}
+
+// Select evaluates an expression that produces a node-set, nodes are returned
+// in document order
+func (x *XPath) Select(node *Node) ([]*Node, error) {
+	v, err := x.Evaluate(node)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := v.([]*Node)
+	if !ok {
+		return nil, fmt.Errorf("xpath: %q does not evaluate to a node-set", x.src)
+	}
+	return nodes, nil
+}
+
+// SelectFirst returns the first selected node in document order, or nil
+func (x *XPath) SelectFirst(node *Node) (*Node, error) {
+	nodes, err := x.Select(node)
+	if err != nil || len(nodes) == 0 {
+		return nil, err
+	}
+	return nodes[0], nil
+}
+
+// EvalString evaluates the expression and converts the result with the
+// string() function
+func (x *XPath) EvalString(node *Node) (string, error) {
+	v, err := x.root.eval(&xctx{ev: &xeval{}, node: fromNode(node), pos: 1, size: 1})
+	if err != nil {
+		return "", err
+	}
+	return toXString(v), nil
+}
+
+// EvalNumber evaluates the expression and converts the result with the
+// number() function
+func (x *XPath) EvalNumber(node *Node) (float64, error) {
+	v, err := x.root.eval(&xctx{ev: &xeval{}, node: fromNode(node), pos: 1, size: 1})
+	if err != nil {
+		return math.NaN(), err
+	}
+	return toXNumber(v), nil
+}
+
+// EvalBool evaluates the expression and converts the result with the
+// boolean() function
+func (x *XPath) EvalBool(node *Node) (bool, error) {
+	v, err := x.root.eval(&xctx{ev: &xeval{}, node: fromNode(node), pos: 1, size: 1})
+	if err != nil {
+		return false, err
+	}
+	return toXBool(v), nil
+}
+
+// xnode is a node of the XPath data model: a tree node, or an attribute or a
+// namespace node that belongs to an element
+type xnode struct {
+	n      *Node
+	attr   int    // attribute index, xself or xnamespace
+	prefix string // namespace node prefix
+}
+
+const (
+	xself      = -1
+	xnamespace = -2
+)
+
+func fromNode(n *Node) xnode {
+	if n == nil {
+		return xnode{n: NewDocument(), attr: xself}
+	}
+	switch n.Kind {
+	case AttributeNode:
+		if n.Parent != nil {
+			for i, a := range n.Parent.Attrs {
+				if a.Name == n.Name {
+					return xnode{n: n.Parent, attr: i}
+				}
+			}
+		}
+	case NamespaceNode:
+		if n.Parent != nil {
+			return xnode{n: n.Parent, attr: xnamespace, prefix: string(n.Name)}
+		}
+	}
+	return xnode{n: n, attr: xself}
+}
+
+func (x xnode) toNode() *Node {
+	switch {
+	case x.attr >= 0:
+		a := x.n.Attrs[x.attr]
+		return &Node{Kind: AttributeNode, Name: a.Name, Value: a.Value, Parent: x.n, SrcPos: a.SrcPos, SrcEnd: -1}
+	case x.attr == xnamespace:
+		uri, _ := x.n.LookupNamespace(x.prefix)
+		return &Node{Kind: NamespaceNode, Name: NameString(x.prefix), Value: uri, Parent: x.n, SrcPos: -1, SrcEnd: -1}
+	}
+	return x.n
+}
+
+func (x xnode) kind() NodeKind {
+	switch {
+	case x.attr >= 0:
+		return AttributeNode
+	case x.attr == xnamespace:
+		return NamespaceNode
+	}
+	if x.n.Kind == CDataNode {
+		return TextNode
+	}
+	return x.n.Kind
+}
+
+func (x xnode) qname() NameString {
+	switch {
+	case x.attr >= 0:
+		return x.n.Attrs[x.attr].Name
+	case x.attr == xnamespace:
+		return NameString(x.prefix)
+	}
+	switch x.n.Kind {
+	case ElementNode, PINode, AttributeNode, NamespaceNode:
+		return x.n.Name
+	}
+	return ""
+}
+
+func (x xnode) localName() string {
+	if x.attr == xnamespace || x.kind() == PINode {
+		return string(x.qname())
+	}
+	_, local := splitQName(x.qname())
+	return local
+}
+
+func (x xnode) namespaceURI() string {
+	switch x.kind() {
+	case ElementNode:
+		return x.n.NamespaceURI()
+	case AttributeNode:
+		if x.attr < 0 {
+			return x.n.NamespaceURI()
+		}
+		prefix, _ := splitQName(x.qname())
+		if prefix == "" {
+			return ""
+		}
+		uri, _ := x.n.LookupNamespace(prefix)
+		return uri
+	}
+	return ""
+}
+
+func (x xnode) stringValue() string {
+	switch {
+	case x.attr >= 0:
+		return x.n.Attrs[x.attr].Value
+	case x.attr == xnamespace:
+		uri, _ := x.n.LookupNamespace(x.prefix)
+		return uri
+	}
+	switch x.n.Kind {
+	case DocumentNode, ElementNode:
+		return x.n.Text()
+	}
+	return x.n.Value
+}
+
+// xeval holds the state of a single evaluation
+type xeval struct {
+	vars  map[string]interface{}
+	order map[*Node]int
+}
+
+type xctx struct {
+	ev   *xeval
+	node xnode
+	pos  int
+	size int
+}
+
+// docOrder numbers the nodes of the tree that contains n
+func (ev *xeval) docOrder(n *Node) int {
+	if i, ok := ev.order[n]; ok {
+		return i
+	}
+	if ev.order == nil {
+		ev.order = map[*Node]int{}
+	}
+	root := n
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	next := len(ev.order)
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		ev.order[n] = next
+		next++
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return ev.order[n]
+}
+
+func (ev *xeval) less(a, b xnode) bool {
+	if a.n != b.n {
+		return ev.docOrder(a.n) < ev.docOrder(b.n)
+	}
+	// the node itself, then its namespace nodes, then attributes
+	rank := func(x xnode) int {
+		switch {
+		case x.attr == xself:
+			return 0
+		case x.attr == xnamespace:
+			return 1
+		}
+		return 2
+	}
+	ra, rb := rank(a), rank(b)
+	if ra != rb {
+		return ra < rb
+	}
+	if ra == 1 {
+		return a.prefix < b.prefix
+	}
+	return a.attr < b.attr
+}
+
+// sortNodes sorts the node-set in document order and removes duplicates
+func (ev *xeval) sortNodes(nodes []xnode) []xnode {
+	if len(nodes) < 2 {
+		return nodes
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return ev.less(nodes[i], nodes[j]) })
+	ret := nodes[:1]
+	for _, n := range nodes[1:] {
+		if n != ret[len(ret)-1] {
+			ret = append(ret, n)
+		}
+	}
+	return ret
+}
+
+func toXString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case float64:
+		return formatXNumber(v)
+	case []xnode:
+		if len(v) == 0 {
+			return ""
+		}
+		return v[0].stringValue()
+	}
+	return ""
+}
+
+func formatXNumber(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == 0:
+		return "0"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func toXNumber(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case string:
+		return parseXNumber(v)
+	case []xnode:
+		return parseXNumber(toXString(v))
+	}
+	return math.NaN()
+}
+
+// parseXNumber implements the XPath number syntax: optional minus sign and
+// decimal digits with an optional fraction, surrounded by whitespace
+func parseXNumber(s string) float64 {
+	s = strings.Trim(s, " \t\r\n")
+	t := strings.TrimPrefix(s, "-")
+	if t == "" || t == "." {
+		return math.NaN()
+	}
+	dot := false
+	for i := 0; i < len(t); i++ {
+		c := t[i]
+		if c == '.' && !dot {
+			dot = true
+		} else if !isDecDigit(c) {
+			return math.NaN()
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return f
+}
+
+func toXBool(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	case []xnode:
+		return len(v) > 0
+	}
+	return false
+}
+
+var errXPathVarType = errors.New("unsupported variable type")
+
+func fromXVar(ev *xeval, v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string, bool, float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float32:
+		return float64(v), nil
+	case *Node:
+		return []xnode{fromNode(v)}, nil
+	case []*Node:
+		nodes := make([]xnode, len(v))
+		for i, n := range v {
+			nodes[i] = fromNode(n)
+		}
+		return ev.sortNodes(nodes), nil
+	}
+	return nil, errXPathVarType
+}
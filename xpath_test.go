@@ -0,0 +1,225 @@
+package xg
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const xpathExample = `<?xml version="1.0" encoding="UTF-8"?>
+<store xmlns:m="urn:media" xml:lang="en-US">
+	<item type="book" id="i1"><title>Go</title><price>12.5</price></item>
+	<item type="book" id="i2"><title>XML</title><price>8</price></item>
+	<item type="cd" id="i3"><title>Jazz</title><price>15</price></item>
+	<m:disc m:format="lp"><title>Blues</title></m:disc>
+	<!-- end -->
+</store>`
+
+func xpathDoc(t *testing.T) *Node {
+	t.Helper()
+	doc, err := ParseDocument(xpathExample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func describeNodes(nodes []*Node) string {
+	var parts []string
+	for _, n := range nodes {
+		switch n.Kind {
+		case ElementNode:
+			parts = append(parts, string(n.Name))
+		case AttributeNode:
+			parts = append(parts, "@"+string(n.Name)+"="+n.Value)
+		case NamespaceNode:
+			parts = append(parts, "ns:"+string(n.Name))
+		case TextNode:
+			parts = append(parts, "'"+n.Value+"'")
+		default:
+			parts = append(parts, n.Kind.String())
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestXPathSelect(t *testing.T) {
+	doc := xpathDoc(t)
+	ns := map[string]string{"media": "urn:media"}
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"/store/item/title", "title,title,title"},
+		{"//item[@type='book' and price > 10]/title", "title"},
+		{"//item[price > 10]/@id", "@id=i1,@id=i3"},
+		{"//item[2]", "item"},
+		{"//item[last()]/@id", "@id=i3"},
+		{"(//title)[position() < 3]/text()", "'Go','XML'"},
+		{"//title[. = 'Jazz']/ancestor::*", "store,item"},
+		{"//item[1]/following-sibling::*", "item,item,m:disc"},
+		{"//item[3]/preceding-sibling::item[1]/@id", "@id=i2"},
+		{"//price[. = 8]/preceding::title", "title,title"},
+		{"//item[@id='i2']/following::title", "title,title"},
+		{"//media:disc/@media:format", "@m:format=lp"},
+		{"//media:*/title", "title"},
+		{"/store/@*", "@xml:lang=en-US"},
+		{"/store/namespace::*", "ns:m,ns:xml"},
+		{"//comment()", "Comment"},
+		{"//item/@id/..", "item,item,item"},
+		{"//@id/following::price[1]", "price,price,price"},
+		{"//item[@type='cd'] | //item[@type='book'][1]", "item,item"},
+		{"id('i3 i1')/title", "title,title"},
+		{"//*[lang('en')][@type='cd']", "item"},
+		{"//item[not(@type='book')]/title", "title"},
+		{"//title[starts-with(., 'X') or contains(., 'azz')]", "title,title"},
+		{"/descendant-or-self::node()[self::title][3]", "title"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			x, err := CompileXPath(tt.expr, ns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nodes, err := x.Select(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describeNodes(nodes); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestXPathValues(t *testing.T) {
+	doc := xpathDoc(t)
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"count(//item)", "3"},
+		{"sum(//price)", "35.5"},
+		{"sum(//price) div count(//price)", "11.833333333333334"},
+		{"7 mod 3 * -1", "-1"},
+		{"1 div 0", "Infinity"},
+		{"0 div 0", "NaN"},
+		{"string(//item[2]/price)", "8"},
+		{"concat(name(/*), '-', local-name(//m:disc), '-', namespace-uri(//m:disc))", "store-disc-urn:media"},
+		{"substring('12345', 1.5, 2.6)", "234"},
+		{"substring('12345', 0, 3)", "12"},
+		{"substring('ÀÁÂ', 2)", "ÁÂ"},
+		{"substring-before('1999/04/01', '/')", "1999"},
+		{"substring-after('1999/04/01', '/')", "04/01"},
+		{"string-length('ÀÁÂ')", "3"},
+		{"normalize-space('  a \n b  ')", "a b"},
+		{"translate('--aaa--', 'abc-', 'ABC')", "AAA"},
+		{"round(2.5)", "3"},
+		{"round(-2.5)", "-2"},
+		{"floor(-1.5) + ceiling(1.2)", "0"},
+		{"number('  12 ')", "12"},
+		{"number('1e3')", "NaN"},
+		{"//item/price = 8", "true"},
+		{"//item/price != 8", "true"},
+		{"//price > //title", "false"},
+		{"true() = //nothing", "false"},
+		{"'1' = 1.0", "true"},
+		{"boolean('false')", "true"},
+		{"//item[1]/title = //item/title", "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			x, err := CompileXPath(tt.expr, map[string]string{"m": "urn:media"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := x.EvalString(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+	if n, _ := MustCompileXPath("round(-0.2)", nil).EvalNumber(doc); n != 0 || !math.Signbit(n) {
+		t.Errorf("round(-0.2) = %v, want -0", n)
+	}
+}
+
+func TestXPathVariables(t *testing.T) {
+	doc := xpathDoc(t)
+	items := MustCompileXPath("//item", nil)
+	nodes, err := items.Select(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := MustCompileXPath("$items[@type=$type]/title", nil)
+	v, err := x.EvaluateVars(doc, map[string]interface{}{"items": nodes, "type": "cd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := describeNodes(v.([]*Node)); got != "title" {
+		t.Errorf("got %s", got)
+	}
+	if _, err := x.Evaluate(doc); err == nil || err.Error() != "xpath: undefined variable $items" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// attribute nodes can be used as context
+	attr, _ := MustCompileXPath("//item[2]/@id", nil).SelectFirst(doc)
+	if s, _ := MustCompileXPath("string(../title)", nil).EvalString(attr); s != "XML" {
+		t.Errorf("attribute context: got %q", s)
+	}
+}
+
+func TestXPathErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"//item[", "xpath: node test expected at offset 7 in \"//item[\""},
+		{"foo(1)", "xpath: unknown function 'foo' at offset 0 in \"foo(1)\""},
+		{"count()", "xpath: wrong number of arguments for 'count' at offset 0 in \"count()\""},
+		{"//p:x", "xpath: unbound namespace prefix 'p' at offset 2 in \"//p:x\""},
+		{"bogus::x", "xpath: unknown axis 'bogus' at offset 0 in \"bogus::x\""},
+		{"'abc", "xpath: unterminated literal at offset 0 in \"'abc\""},
+		{"a b", "xpath: operator expected at offset 2 in \"a b\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := CompileXPath(tt.expr, nil)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("got %v, want %s", err, tt.err)
+			}
+		})
+	}
+
+	doc := xpathDoc(t)
+	if _, err := MustCompileXPath("count(1)", nil).Evaluate(doc); err == nil {
+		t.Errorf("expected a node-set error")
+	}
+	if _, err := MustCompileXPath("1 + 1", nil).Select(doc); err == nil {
+		t.Errorf("expected a node-set error")
+	}
+}
+
+func TestXPathConcurrent(t *testing.T) {
+	doc := xpathDoc(t)
+	x := MustCompileXPath("count(//item[price > 10]/following::*)", nil)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if n, err := x.EvalNumber(doc); err != nil || n != 8 {
+					t.Errorf("got %v, %v", n, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}